@@ -0,0 +1,125 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CRDResource is the group-resource the CRD analysis works on
+var CRDResource = schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+
+// ObjectCounter counts the objects of a resource in the scanned part of the cluster
+type ObjectCounter interface {
+	CountObjects(ctx context.Context, gvr schema.GroupVersionResource, namespaced bool) (int64, error)
+}
+
+// CRDFinding reports the deprecated versions of a CRD and whether its stored objects have to be
+// migrated to the storage version before an operator upgrade drops the old versions. The total
+// object count covers every object of the CRD, the API server not telling which of them are still
+// stored in a stale version.
+type CRDFinding struct {
+	Name                string                 `json:"name"`
+	Group               string                 `json:"group"`
+	Kind                string                 `json:"kind"`
+	StorageVersion      string                 `json:"storageVersion"`
+	StoredVersions      []string               `json:"storedVersions"`
+	DeprecatedVersions  []DeprecatedCRDVersion `json:"deprecatedVersions,omitempty"`
+	StaleStoredVersions []string               `json:"staleStoredVersions,omitempty"`
+	MigrationNeeded     bool                   `json:"migrationNeeded"`
+	TotalObjectCount    *int64                 `json:"totalObjectCount,omitempty"`
+	Advice              []string               `json:"advice,omitempty"`
+}
+
+// DeprecatedCRDVersion is a CRD version flagged `deprecated: true`
+type DeprecatedCRDVersion struct {
+	Name               string `json:"name"`
+	Served             bool   `json:"served"`
+	DeprecationWarning string `json:"deprecationWarning,omitempty"`
+}
+
+// AnalyzeCRDs reports the CRDs with deprecated versions or with objects possibly stored in a version
+// other than the storage version. The objects of the CRDs needing a storage migration are counted
+// when a counter is given, every object being a candidate for the migration.
+func AnalyzeCRDs(ctx context.Context, crds []unstructured.Unstructured, counter ObjectCounter) []CRDFinding {
+	var findings []CRDFinding
+	for _, obj := range crds {
+		var crd apiextensionsv1.CustomResourceDefinition
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &crd); err != nil {
+			logrus.Warnf("unable to parse the custom resource definition %s: %v", obj.GetName(), err)
+			continue
+		}
+
+		finding := analyzeCRD(&crd)
+		if len(finding.DeprecatedVersions) == 0 && !finding.MigrationNeeded {
+			continue
+		}
+		if finding.MigrationNeeded && counter != nil {
+			gvr := schema.GroupVersionResource{Group: crd.Spec.Group, Version: finding.StorageVersion, Resource: crd.Spec.Names.Plural}
+			count, err := counter.CountObjects(ctx, gvr, crd.Spec.Scope == apiextensionsv1.NamespaceScoped)
+			if err != nil {
+				logrus.Warnf("unable to count the objects of %s: %v", crd.Name, err)
+			} else {
+				finding.TotalObjectCount = &count
+			}
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+func analyzeCRD(crd *apiextensionsv1.CustomResourceDefinition) CRDFinding {
+	finding := CRDFinding{
+		Name:           crd.Name,
+		Group:          crd.Spec.Group,
+		Kind:           crd.Spec.Names.Kind,
+		StoredVersions: crd.Status.StoredVersions,
+	}
+
+	served := make(map[string]bool)
+	deprecated := make(map[string]bool)
+	for _, version := range crd.Spec.Versions {
+		served[version.Name] = version.Served
+		if version.Storage {
+			finding.StorageVersion = version.Name
+		}
+		if version.Deprecated {
+			deprecated[version.Name] = true
+			deprecatedVersion := DeprecatedCRDVersion{Name: version.Name, Served: version.Served}
+			if version.DeprecationWarning != nil {
+				deprecatedVersion.DeprecationWarning = *version.DeprecationWarning
+			}
+			finding.DeprecatedVersions = append(finding.DeprecatedVersions, deprecatedVersion)
+		}
+	}
+
+	for _, storedVersion := range crd.Status.StoredVersions {
+		if storedVersion == finding.StorageVersion {
+			continue
+		}
+		finding.StaleStoredVersions = append(finding.StaleStoredVersions, storedVersion)
+		finding.MigrationNeeded = true
+
+		reason := "is no longer the storage version"
+		if !served[storedVersion] {
+			reason = "is no longer served"
+		} else if deprecated[storedVersion] {
+			reason = "is deprecated and about to be removed"
+		}
+		finding.Advice = append(finding.Advice, fmt.Sprintf("%s %s but still listed in status.storedVersions; rewrite every %s in the storage version %s "+
+			"(e.g. with kube-storage-version-migrator or a no-op update of each object) and then remove %s from status.storedVersions "+
+			"before upgrading the operator", storedVersion, reason, crd.Spec.Names.Kind, finding.StorageVersion, storedVersion))
+	}
+
+	for _, version := range finding.DeprecatedVersions {
+		if version.Served {
+			finding.Advice = append(finding.Advice, fmt.Sprintf("move the manifests and clients using %s/%s %s to %s/%s",
+				crd.Spec.Group, version.Name, crd.Spec.Names.Kind, crd.Spec.Group, finding.StorageVersion))
+		}
+	}
+	return finding
+}
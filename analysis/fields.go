@@ -0,0 +1,284 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldRule flags a deprecated field, annotation or label used in a manifest. Rules marked with
+// PodTemplate are evaluated against the pod template of the workloads and against pods.
+type FieldRule struct {
+	Name  string
+	Kinds []string
+	// PodTemplate makes the Path relative to the pod or the pod template of a workload
+	PodTemplate bool
+	// Path holds the field names to walk, `[]` walking every element of a list
+	Path []string
+	// KeyPrefix matches the last field of the Path as a prefix of the map keys
+	KeyPrefix bool
+	// Value, when set, has to be the value of the field for the rule to match
+	Value        string
+	Replacement  string
+	DeprecatedIn string
+	RemovedIn    string
+}
+
+// FieldFinding is a deprecated field, annotation or label found in a manifest
+type FieldFinding struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace,omitempty"`
+	Kind         string `json:"kind"`
+	ApiVersion   string `json:"apiVersion"`
+	Rule         string `json:"rule"`
+	Path         string `json:"path"`
+	Replacement  string `json:"replacement,omitempty"`
+	DeprecatedIn string `json:"deprecatedIn,omitempty"`
+	RemovedIn    string `json:"removedIn,omitempty"`
+}
+
+// podTemplatePaths locates the pod template in the workload kinds
+var podTemplatePaths = map[string][]string{
+	"Pod":                   {},
+	"Deployment":            {"spec", "template"},
+	"ReplicaSet":            {"spec", "template"},
+	"StatefulSet":           {"spec", "template"},
+	"DaemonSet":             {"spec", "template"},
+	"ReplicationController": {"spec", "template"},
+	"Job":                   {"spec", "template"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template"},
+}
+
+// FieldRules are the deprecated fields, annotations and labels checked in the collected manifests
+var FieldRules = []FieldRule{
+	{
+		Name:         "ingress class annotation",
+		Kinds:        []string{"Ingress"},
+		Path:         []string{"metadata", "annotations", "kubernetes.io/ingress.class"},
+		Replacement:  "spec.ingressClassName",
+		DeprecatedIn: "1.18",
+	},
+	{
+		Name:         "seccomp pod annotation",
+		PodTemplate:  true,
+		Path:         []string{"metadata", "annotations", "seccomp.security.alpha.kubernetes.io/pod"},
+		Replacement:  "spec.securityContext.seccompProfile",
+		DeprecatedIn: "1.19",
+		RemovedIn:    "1.27",
+	},
+	{
+		Name:         "seccomp container annotation",
+		PodTemplate:  true,
+		Path:         []string{"metadata", "annotations", "container.seccomp.security.alpha.kubernetes.io/"},
+		KeyPrefix:    true,
+		Replacement:  "spec.containers[].securityContext.seccompProfile",
+		DeprecatedIn: "1.19",
+		RemovedIn:    "1.27",
+	},
+	{
+		Name:         "apparmor container annotation",
+		PodTemplate:  true,
+		Path:         []string{"metadata", "annotations", "container.apparmor.security.beta.kubernetes.io/"},
+		KeyPrefix:    true,
+		Replacement:  "spec.containers[].securityContext.appArmorProfile",
+		DeprecatedIn: "1.30",
+	},
+	{
+		Name:         "critical pod annotation",
+		PodTemplate:  true,
+		Path:         []string{"metadata", "annotations", "scheduler.alpha.kubernetes.io/critical-pod"},
+		Replacement:  "spec.priorityClassName",
+		DeprecatedIn: "1.13",
+		RemovedIn:    "1.16",
+	},
+	{
+		Name:         "service account alias",
+		PodTemplate:  true,
+		Path:         []string{"spec", "serviceAccount"},
+		Replacement:  "spec.serviceAccountName",
+		DeprecatedIn: "1.8",
+	},
+	{
+		Name:         "beta os node selector",
+		PodTemplate:  true,
+		Path:         []string{"spec", "nodeSelector", "beta.kubernetes.io/os"},
+		Replacement:  "kubernetes.io/os",
+		DeprecatedIn: "1.14",
+	},
+	{
+		Name:         "beta arch node selector",
+		PodTemplate:  true,
+		Path:         []string{"spec", "nodeSelector", "beta.kubernetes.io/arch"},
+		Replacement:  "kubernetes.io/arch",
+		DeprecatedIn: "1.14",
+	},
+	{
+		Name:         "beta zone node selector",
+		PodTemplate:  true,
+		Path:         []string{"spec", "nodeSelector", "failure-domain.beta.kubernetes.io/zone"},
+		Replacement:  "topology.kubernetes.io/zone",
+		DeprecatedIn: "1.17",
+	},
+	{
+		Name:         "beta region node selector",
+		PodTemplate:  true,
+		Path:         []string{"spec", "nodeSelector", "failure-domain.beta.kubernetes.io/region"},
+		Replacement:  "topology.kubernetes.io/region",
+		DeprecatedIn: "1.17",
+	},
+	{
+		Name:         "beta zone node affinity",
+		PodTemplate:  true,
+		Path:         []string{"spec", "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms", "[]", "matchExpressions", "[]", "key"},
+		Value:        "failure-domain.beta.kubernetes.io/zone",
+		Replacement:  "topology.kubernetes.io/zone",
+		DeprecatedIn: "1.17",
+	},
+	{
+		Name:         "beta region node affinity",
+		PodTemplate:  true,
+		Path:         []string{"spec", "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms", "[]", "matchExpressions", "[]", "key"},
+		Value:        "failure-domain.beta.kubernetes.io/region",
+		Replacement:  "topology.kubernetes.io/region",
+		DeprecatedIn: "1.17",
+	},
+	{
+		Name:         "service topology keys",
+		Kinds:        []string{"Service"},
+		Path:         []string{"spec", "topologyKeys"},
+		Replacement:  "topology aware routing with the service.kubernetes.io/topology-mode annotation",
+		DeprecatedIn: "1.21",
+		RemovedIn:    "1.22",
+	},
+	{
+		Name:         "tolerate unready endpoints annotation",
+		Kinds:        []string{"Service"},
+		Path:         []string{"metadata", "annotations", "service.alpha.kubernetes.io/tolerate-unready-endpoints"},
+		Replacement:  "spec.publishNotReadyAddresses",
+		DeprecatedIn: "1.11",
+	},
+	{
+		Name:         "beta default storage class annotation",
+		Kinds:        []string{"StorageClass"},
+		Path:         []string{"metadata", "annotations", "storageclass.beta.kubernetes.io/is-default-class"},
+		Replacement:  "storageclass.kubernetes.io/is-default-class",
+		DeprecatedIn: "1.6",
+	},
+	{
+		Name:         "beta storage class annotation",
+		Kinds:        []string{"PersistentVolumeClaim"},
+		Path:         []string{"metadata", "annotations", "volume.beta.kubernetes.io/storage-class"},
+		Replacement:  "spec.storageClassName",
+		DeprecatedIn: "1.8",
+	},
+	{
+		Name:         "beta storage provisioner annotation",
+		Kinds:        []string{"PersistentVolumeClaim"},
+		Path:         []string{"metadata", "annotations", "volume.beta.kubernetes.io/storage-provisioner"},
+		Replacement:  "volume.kubernetes.io/storage-provisioner",
+		DeprecatedIn: "1.23",
+	},
+}
+
+// AnalyzeFields evaluates the field rules over the given manifests
+func AnalyzeFields(manifests []map[string]interface{}, rules []FieldRule) []FieldFinding {
+	var findings []FieldFinding
+	for _, manifest := range manifests {
+		kind, _ := manifest["kind"].(string)
+		apiVersion, _ := manifest["apiVersion"].(string)
+		metadata, _ := manifest["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		namespace, _ := metadata["namespace"].(string)
+
+		for _, rule := range rules {
+			root := []string{}
+			if rule.PodTemplate {
+				templatePath, isWorkload := podTemplatePaths[kind]
+				if !isWorkload {
+					continue
+				}
+				root = templatePath
+			} else if !hasKind(rule.Kinds, kind) {
+				continue
+			}
+
+			for _, path := range matchPath(manifest, append(append([]string{}, root...), rule.Path...), rule) {
+				findings = append(findings, FieldFinding{
+					Name:         name,
+					Namespace:    namespace,
+					Kind:         kind,
+					ApiVersion:   apiVersion,
+					Rule:         rule.Name,
+					Path:         path,
+					Replacement:  rule.Replacement,
+					DeprecatedIn: rule.DeprecatedIn,
+					RemovedIn:    rule.RemovedIn,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func hasKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath walks the path in the manifest and returns the JSON paths of the matching fields
+func matchPath(manifest map[string]interface{}, path []string, rule FieldRule) []string {
+	var matches []string
+	var walk func(node interface{}, depth int, jsonPath string)
+	walk = func(node interface{}, depth int, jsonPath string) {
+		if depth == len(path) {
+			if rule.Value == "" || fmt.Sprint(node) == rule.Value {
+				matches = append(matches, jsonPath)
+			}
+			return
+		}
+
+		segment := path[depth]
+		if segment == "[]" {
+			items, _ := node.([]interface{})
+			for i, item := range items {
+				walk(item, depth+1, fmt.Sprintf("%s[%d]", jsonPath, i))
+			}
+			return
+		}
+
+		fields, ok := node.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if rule.KeyPrefix && depth == len(path)-1 {
+			keys := make([]string, 0, len(fields))
+			for key := range fields {
+				if strings.HasPrefix(key, segment) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(fields[key], depth+1, jsonPath+fieldPath(key))
+			}
+			return
+		}
+		if value, found := fields[segment]; found && value != nil {
+			walk(value, depth+1, jsonPath+fieldPath(segment))
+		}
+	}
+	walk(manifest, 0, "$")
+	return matches
+}
+
+// fieldPath renders a field in the JSON path notation, quoting the keys that aren't plain names
+func fieldPath(key string) string {
+	if strings.ContainsAny(key, "./-") {
+		return fmt.Sprintf("['%s']", key)
+	}
+	return "." + key
+}
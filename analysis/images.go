@@ -0,0 +1,160 @@
+package analysis
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"strings"
+)
+
+// ImageResources are the group-resources whose pod specs are checked for deprecated registries.
+// The images are read from the pod templates of the workload controllers rather than from the
+// pods, which would mean listing every pod of the cluster.
+var ImageResources = []schema.GroupResource{
+	{Group: "apps", Resource: "deployments"},
+	{Group: "apps", Resource: "statefulsets"},
+	{Group: "apps", Resource: "daemonsets"},
+	{Group: "apps", Resource: "replicasets"},
+	{Group: "batch", Resource: "cronjobs"},
+	{Group: "batch", Resource: "jobs"},
+}
+
+// DeprecatedRegistry is a frozen or retired image registry and the prefix replacing it
+type DeprecatedRegistry struct {
+	Prefix      string `json:"prefix"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// DefaultDeprecatedRegistries are the retired Kubernetes project registries
+var DefaultDeprecatedRegistries = []DeprecatedRegistry{
+	{Prefix: "k8s.gcr.io", Replacement: "registry.k8s.io"},
+	{Prefix: "gcr.io/google-containers", Replacement: "registry.k8s.io"},
+	{Prefix: "gcr.io/google_containers", Replacement: "registry.k8s.io"},
+	{Prefix: "us.gcr.io/k8s-artifacts-prod", Replacement: "registry.k8s.io"},
+	{Prefix: "eu.gcr.io/k8s-artifacts-prod", Replacement: "registry.k8s.io"},
+	{Prefix: "asia.gcr.io/k8s-artifacts-prod", Replacement: "registry.k8s.io"},
+}
+
+// ImageFinding is a container image pulled from a deprecated registry
+type ImageFinding struct {
+	Name           string `json:"name"`
+	Namespace      string `json:"namespace,omitempty"`
+	Kind           string `json:"kind"`
+	ApiVersion     string `json:"apiVersion"`
+	Container      string `json:"container"`
+	Image          string `json:"image"`
+	Registry       string `json:"registry"`
+	SuggestedImage string `json:"suggestedImage,omitempty"`
+}
+
+// AnalyzeImages flags the containers, init containers and ephemeral containers of the given workloads
+// whose images come from one of the deprecated registries. Objects owned by another object are
+// skipped as their owner carries the same pod template, e.g. the ReplicaSets of a Deployment or the
+// Jobs of a CronJob.
+func AnalyzeImages(objects []unstructured.Unstructured, registries []DeprecatedRegistry) []ImageFinding {
+	var findings []ImageFinding
+	for i := range objects {
+		obj := &objects[i]
+		if len(obj.GetOwnerReferences()) > 0 {
+			continue
+		}
+		podSpec, found := podSpecOf(obj)
+		if !found {
+			continue
+		}
+
+		check := func(container, image string) {
+			registry, suggestedImage, deprecated := matchDeprecatedRegistry(image, registries)
+			if !deprecated {
+				return
+			}
+			findings = append(findings, ImageFinding{
+				Name:           obj.GetName(),
+				Namespace:      obj.GetNamespace(),
+				Kind:           obj.GetKind(),
+				ApiVersion:     obj.GetAPIVersion(),
+				Container:      container,
+				Image:          image,
+				Registry:       registry.Prefix,
+				SuggestedImage: suggestedImage,
+			})
+		}
+		for _, container := range append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+			check(container.Name, container.Image)
+		}
+		for _, container := range podSpec.EphemeralContainers {
+			check(container.Name, container.Image)
+		}
+	}
+	return findings
+}
+
+// matchDeprecatedRegistry returns the deprecated registry the image is pulled from along with the
+// image rewritten to the replacement prefix; the longest matching prefix wins
+func matchDeprecatedRegistry(image string, registries []DeprecatedRegistry) (DeprecatedRegistry, string, bool) {
+	reference := normalizeImage(image)
+	var match DeprecatedRegistry
+	matched := false
+	for _, registry := range registries {
+		prefix := strings.TrimSuffix(registry.Prefix, "/")
+		if !strings.HasPrefix(reference, prefix+"/") {
+			continue
+		}
+		if !matched || len(prefix) > len(strings.TrimSuffix(match.Prefix, "/")) {
+			match = registry
+			matched = true
+		}
+	}
+	if !matched {
+		return match, "", false
+	}
+	if match.Replacement == "" {
+		return match, "", true
+	}
+	suggestedImage := fmt.Sprintf("%s/%s", strings.TrimSuffix(match.Replacement, "/"), strings.TrimPrefix(reference, strings.TrimSuffix(match.Prefix, "/")+"/"))
+	return match, suggestedImage, true
+}
+
+// normalizeImage prefixes the images without a registry host with the docker hub registry,
+// following the image reference rules of the container runtimes
+func normalizeImage(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return "docker.io/library/" + image
+	}
+	if host := image[:i]; !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "docker.io/" + image
+	}
+	return image
+}
+
+// ParseDeprecatedRegistries parses a comma separated list of `prefix=replacement` entries, the
+// replacement being optional, and merges them over the given registries; an entry for an already
+// listed prefix overrides its replacement
+func ParseDeprecatedRegistries(value string, registries []DeprecatedRegistry) ([]DeprecatedRegistry, error) {
+	merged := append([]DeprecatedRegistry{}, registries...)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, replacement, _ := strings.Cut(entry, "=")
+		prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "/")
+		if prefix == "" {
+			return nil, fmt.Errorf("missing the registry prefix in '%s'", entry)
+		}
+		registry := DeprecatedRegistry{Prefix: prefix, Replacement: strings.TrimSpace(replacement)}
+
+		overridden := false
+		for i := range merged {
+			if merged[i].Prefix == prefix {
+				merged[i] = registry
+				overridden = true
+			}
+		}
+		if !overridden {
+			merged = append(merged, registry)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func workload(kind, name, image string, templatePath []string, owned bool) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind(kind)
+	obj.SetNamespace("shop")
+	obj.SetName(name)
+	if owned {
+		obj.SetOwnerReferences([]metav1.OwnerReference{{Kind: "Owner", Name: "owner"}})
+	}
+	containers := []interface{}{map[string]interface{}{"name": "app", "image": image}}
+	if err := unstructured.SetNestedSlice(obj.Object, containers, append(append([]string{}, templatePath...), "spec", "containers")...); err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+func TestAnalyzeImages(t *testing.T) {
+	objects := []unstructured.Unstructured{
+		workload("Deployment", "web", "k8s.gcr.io/pause:3.2", podTemplatePaths["Deployment"], false),
+		// the replicasets of the deployment carry its template
+		workload("ReplicaSet", "web-5d9c", "k8s.gcr.io/pause:3.2", podTemplatePaths["ReplicaSet"], true),
+		workload("Job", "migrate", "gcr.io/google_containers/busybox", podTemplatePaths["Job"], false),
+		workload("Job", "backup-2765", "k8s.gcr.io/etcd:3.5.0", podTemplatePaths["Job"], true),
+		workload("CronJob", "backup", "k8s.gcr.io/etcd:3.5.0", podTemplatePaths["CronJob"], false),
+		workload("StatefulSet", "db", "postgres:15", podTemplatePaths["StatefulSet"], false),
+	}
+	findings := AnalyzeImages(objects, DefaultDeprecatedRegistries)
+	want := []ImageFinding{
+		{Kind: "Deployment", Name: "web", Image: "k8s.gcr.io/pause:3.2", Registry: "k8s.gcr.io", SuggestedImage: "registry.k8s.io/pause:3.2"},
+		{Kind: "Job", Name: "migrate", Image: "gcr.io/google_containers/busybox", Registry: "gcr.io/google_containers", SuggestedImage: "registry.k8s.io/busybox"},
+		{Kind: "CronJob", Name: "backup", Image: "k8s.gcr.io/etcd:3.5.0", Registry: "k8s.gcr.io", SuggestedImage: "registry.k8s.io/etcd:3.5.0"},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("got %d findings, want %d: %+v", len(findings), len(want), findings)
+	}
+	for i, finding := range findings {
+		if finding.Kind != want[i].Kind || finding.Name != want[i].Name || finding.Image != want[i].Image ||
+			finding.Registry != want[i].Registry || finding.SuggestedImage != want[i].SuggestedImage ||
+			finding.Namespace != "shop" || finding.Container != "app" {
+			t.Errorf("got the finding %+v, want %+v", finding, want[i])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package analysis
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"sort"
+	"strings"
+)
+
+// NodeResource is the group-resource the node checks work on
+var NodeResource = schema.GroupResource{Resource: "nodes"}
+
+const (
+	NodeCheckKubeletSkew     = "kubeletSkew"
+	NodeCheckDockershim      = "dockershim"
+	NodeCheckDeprecatedLabel = "deprecatedLabels"
+)
+
+// dockershimRemovedIn is the release the kubelet stopped talking to docker directly
+var dockershimRemovedIn = utilversion.MustParseGeneric("1.24")
+
+// deprecatedNodeLabels maps the deprecated node labels to their replacements
+var deprecatedNodeLabels = map[string]string{
+	"beta.kubernetes.io/os":                    "kubernetes.io/os",
+	"beta.kubernetes.io/arch":                  "kubernetes.io/arch",
+	"beta.kubernetes.io/instance-type":         "node.kubernetes.io/instance-type",
+	"failure-domain.beta.kubernetes.io/zone":   "topology.kubernetes.io/zone",
+	"failure-domain.beta.kubernetes.io/region": "topology.kubernetes.io/region",
+}
+
+// NodeFinding is a node-level upgrade blocker or warning; blocking findings have to be fixed
+// before the control plane is upgraded
+type NodeFinding struct {
+	Node             string            `json:"node"`
+	Check            string            `json:"check"`
+	KubeletVersion   string            `json:"kubeletVersion,omitempty"`
+	ContainerRuntime string            `json:"containerRuntime,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Blocking         bool              `json:"blocking"`
+	Message          string            `json:"message"`
+}
+
+// NodeInfo holds the versions of a node the version checks work on, kept along with the findings
+// to check the nodes again against another target version
+type NodeInfo struct {
+	Name             string `json:"name"`
+	KubeletVersion   string `json:"kubeletVersion,omitempty"`
+	ContainerRuntime string `json:"containerRuntime,omitempty"`
+}
+
+// NodeInfos reads the versions of the nodes
+func NodeInfos(nodes []unstructured.Unstructured) []NodeInfo {
+	infos := make([]NodeInfo, 0, len(nodes))
+	for _, node := range nodes {
+		kubeletVersion, _, _ := unstructured.NestedString(node.Object, "status", "nodeInfo", "kubeletVersion")
+		containerRuntime, _, _ := unstructured.NestedString(node.Object, "status", "nodeInfo", "containerRuntimeVersion")
+		infos = append(infos, NodeInfo{Name: node.GetName(), KubeletVersion: kubeletVersion, ContainerRuntime: containerRuntime})
+	}
+	return infos
+}
+
+// AnalyzeNodes checks the kubelet version skew of the nodes against the control plane and the
+// target version, the nodes still running on dockershim and the deprecated node labels. The
+// target version is optional; the control plane version is skipped when it can't be parsed.
+func AnalyzeNodes(nodes []unstructured.Unstructured, controlPlaneVersion, targetVersion string) []NodeFinding {
+	findings := CheckNodeVersions(NodeInfos(nodes), controlPlaneVersion, targetVersion)
+	for _, node := range nodes {
+		labels := make(map[string]string)
+		for label := range node.GetLabels() {
+			if replacement, deprecated := deprecatedNodeLabels[label]; deprecated {
+				labels[label] = replacement
+			} else if strings.HasPrefix(label, "beta.kubernetes.io/") || strings.HasPrefix(label, "failure-domain.beta.kubernetes.io/") {
+				labels[label] = ""
+			}
+		}
+		if len(labels) > 0 {
+			names := make([]string, 0, len(labels))
+			for label := range labels {
+				names = append(names, label)
+			}
+			sort.Strings(names)
+			findings = append(findings, NodeFinding{
+				Node:    node.GetName(),
+				Check:   NodeCheckDeprecatedLabel,
+				Labels:  labels,
+				Message: fmt.Sprintf("the node carries the deprecated labels %s; move the node selectors, affinities and topology spread constraints to the replacement labels", strings.Join(names, ", ")),
+			})
+		}
+	}
+	return findings
+}
+
+// CheckNodeVersions checks the kubelet version skew of the nodes against the control plane and
+// the target version and the nodes still running on dockershim, the findings blocking depending
+// on the target version
+func CheckNodeVersions(nodes []NodeInfo, controlPlaneVersion, targetVersion string) []NodeFinding {
+	controlPlane, _ := utilversion.ParseGeneric(controlPlaneVersion)
+	target, _ := utilversion.ParseGeneric(targetVersion)
+
+	var findings []NodeFinding
+	for _, node := range nodes {
+		kubelet, err := utilversion.ParseGeneric(node.KubeletVersion)
+		if err != nil {
+			continue
+		}
+		if finding, found := checkKubeletSkew(kubelet, controlPlane, target); found {
+			finding.Node = node.Name
+			finding.KubeletVersion = node.KubeletVersion
+			findings = append(findings, finding)
+		}
+		// from 1.24 on a docker runtime is served through cri-dockerd
+		if strings.HasPrefix(node.ContainerRuntime, "docker://") && kubelet.LessThan(dockershimRemovedIn) {
+			findings = append(findings, NodeFinding{
+				Node:             node.Name,
+				Check:            NodeCheckDockershim,
+				KubeletVersion:   node.KubeletVersion,
+				ContainerRuntime: node.ContainerRuntime,
+				Blocking:         target == nil || target.AtLeast(dockershimRemovedIn),
+				Message: fmt.Sprintf("the node runs on dockershim, which is removed in %s; move the node to containerd, CRI-O or cri-dockerd before upgrading its kubelet",
+					dockershimRemovedIn),
+			})
+		}
+	}
+	return findings
+}
+
+// checkKubeletSkew checks the kubelet against the version skew policy: the kubelet must not be
+// newer than the control plane and may be at most maxKubeletSkew minor versions older
+func checkKubeletSkew(kubelet, controlPlane, target *utilversion.Version) (NodeFinding, bool) {
+	finding := NodeFinding{Check: NodeCheckKubeletSkew, Blocking: true}
+	if controlPlane != nil && kubelet.Major() == controlPlane.Major() {
+		if kubelet.Minor() > controlPlane.Minor() {
+			finding.Message = fmt.Sprintf("the kubelet %d.%d is newer than the control plane %d.%d, which is not supported",
+				kubelet.Major(), kubelet.Minor(), controlPlane.Major(), controlPlane.Minor())
+			return finding, true
+		}
+		if controlPlane.Minor()-kubelet.Minor() > maxKubeletSkew(controlPlane) {
+			finding.Message = fmt.Sprintf("the kubelet %d.%d is already more than %d minor versions older than the control plane %d.%d",
+				kubelet.Major(), kubelet.Minor(), maxKubeletSkew(controlPlane), controlPlane.Major(), controlPlane.Minor())
+			return finding, true
+		}
+	}
+	if target != nil && kubelet.Major() == target.Major() && kubelet.Minor() < target.Minor() &&
+		target.Minor()-kubelet.Minor() > maxKubeletSkew(target) {
+		finding.Message = fmt.Sprintf("the kubelet %d.%d falls out of the supported skew of the target version %d.%d; upgrade the kubelet to at least %d.%d before upgrading the control plane",
+			kubelet.Major(), kubelet.Minor(), target.Major(), target.Minor(), target.Major(), target.Minor()-maxKubeletSkew(target))
+		return finding, true
+	}
+	return finding, false
+}
+
+// maxKubeletSkew is the number of minor versions the kubelet may lag behind the given control
+// plane version, extended from two to three in 1.28
+func maxKubeletSkew(controlPlane *utilversion.Version) uint {
+	if controlPlane.Major() == 1 && controlPlane.Minor() < 28 {
+		return 2
+	}
+	return 3
+}
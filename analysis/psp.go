@@ -0,0 +1,384 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sort"
+	"strings"
+)
+
+// The Pod Security Standards levels, from the least to the most restrictive
+const (
+	LevelPrivileged = "privileged"
+	LevelBaseline   = "baseline"
+	LevelRestricted = "restricted"
+)
+
+const (
+	pspAnnotation       = "kubernetes.io/psp"
+	podSecurityLabelKey = "pod-security.kubernetes.io/"
+)
+
+var (
+	levelOrder = map[string]int{LevelPrivileged: 0, LevelBaseline: 1, LevelRestricted: 2}
+
+	// baselineCapabilities may be added by the containers at the baseline level
+	baselineCapabilities = sets.NewString("AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD",
+		"NET_BIND_SERVICE", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT")
+	// safeSysctls may be set by the pods at the baseline level
+	safeSysctls = sets.NewString("kernel.shm_rmid_forced", "net.ipv4.ip_local_port_range", "net.ipv4.ip_unprivileged_port_start",
+		"net.ipv4.tcp_syncookies", "net.ipv4.ping_group_range")
+	// restrictedVolumes are the volume types allowed at the restricted level
+	restrictedVolumes = sets.NewString("configMap", "csi", "downwardAPI", "emptyDir", "ephemeral", "persistentVolumeClaim",
+		"projected", "secret")
+)
+
+// PSPMigrationReport maps the PodSecurityPolicies to the Pod Security Standards and advises
+// the namespace labels for the Pod Security Admission
+type PSPMigrationReport struct {
+	Policies   []PolicyMapping   `json:"policies"`
+	Namespaces []NamespaceAdvice `json:"namespaces"`
+}
+
+// PolicyMapping is the closest Pod Security Standard level a PodSecurityPolicy allows
+type PolicyMapping struct {
+	Name    string   `json:"name"`
+	Level   string   `json:"level"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// NamespaceAdvice tells the strictest level the workloads of a namespace comply with
+// and the labels to apply for it
+type NamespaceAdvice struct {
+	Namespace       string            `json:"namespace"`
+	Policies        []string          `json:"policies,omitempty"`
+	CurrentLabels   map[string]string `json:"currentLabels,omitempty"`
+	Level           string            `json:"level"`
+	SuggestedLabels map[string]string `json:"suggestedLabels"`
+	Workloads       []WorkloadLevel   `json:"workloads,omitempty"`
+}
+
+// WorkloadLevel is the strictest level a workload complies with, along with the violations of
+// the levels above it
+type WorkloadLevel struct {
+	Kind                 string   `json:"kind"`
+	Name                 string   `json:"name"`
+	Level                string   `json:"level"`
+	BaselineViolations   []string `json:"baselineViolations,omitempty"`
+	RestrictedViolations []string `json:"restrictedViolations,omitempty"`
+}
+
+// AnalyzePSPMigration maps the policies to the Pod Security Standards and checks the pod specs of
+// the workloads and the pods not owned by another object. All the pods tell the policies that
+// admitted them through their annotation.
+func AnalyzePSPMigration(policies, namespaces, workloads, pods []unstructured.Unstructured) *PSPMigrationReport {
+	report := &PSPMigrationReport{
+		Policies:   []PolicyMapping{},
+		Namespaces: []NamespaceAdvice{},
+	}
+	for _, obj := range policies {
+		var psp policyv1beta1.PodSecurityPolicy
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &psp); err != nil {
+			logrus.Warnf("unable to parse the pod security policy %s: %v", obj.GetName(), err)
+			continue
+		}
+		report.Policies = append(report.Policies, mapPolicy(&psp))
+	}
+
+	advices := make(map[string]*NamespaceAdvice)
+	adviceFor := func(namespace string) *NamespaceAdvice {
+		if advice, found := advices[namespace]; found {
+			return advice
+		}
+		advice := &NamespaceAdvice{Namespace: namespace, Level: LevelRestricted}
+		advices[namespace] = advice
+		return advice
+	}
+	for _, ns := range namespaces {
+		advice := adviceFor(ns.GetName())
+		for key, value := range ns.GetLabels() {
+			if strings.HasPrefix(key, podSecurityLabelKey) {
+				if advice.CurrentLabels == nil {
+					advice.CurrentLabels = make(map[string]string)
+				}
+				advice.CurrentLabels[key] = value
+			}
+		}
+	}
+
+	usedPolicies := make(map[string]sets.String)
+	for _, pod := range pods {
+		if psp, found := pod.GetAnnotations()[pspAnnotation]; found {
+			if usedPolicies[pod.GetNamespace()] == nil {
+				usedPolicies[pod.GetNamespace()] = sets.NewString()
+			}
+			usedPolicies[pod.GetNamespace()].Insert(psp)
+		}
+	}
+
+	candidates := append(append([]unstructured.Unstructured{}, workloads...), pods...)
+	for _, workload := range candidates {
+		if len(workload.GetOwnerReferences()) > 0 {
+			continue
+		}
+		podSpec, found := podSpecOf(&workload)
+		if !found {
+			continue
+		}
+		workloadLevel := checkPodSpec(podSpec)
+		workloadLevel.Kind = workload.GetKind()
+		workloadLevel.Name = workload.GetName()
+
+		advice := adviceFor(workload.GetNamespace())
+		advice.Workloads = append(advice.Workloads, workloadLevel)
+		if levelOrder[workloadLevel.Level] < levelOrder[advice.Level] {
+			advice.Level = workloadLevel.Level
+		}
+	}
+
+	for _, advice := range advices {
+		if policies, found := usedPolicies[advice.Namespace]; found {
+			advice.Policies = policies.List()
+		}
+		advice.SuggestedLabels = suggestedLabels(advice.Level)
+		report.Namespaces = append(report.Namespaces, *advice)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+	return report
+}
+
+// suggestedLabels enforces the level the workloads comply with and warns and audits
+// on the next stricter level, if any, to prepare for it
+func suggestedLabels(level string) map[string]string {
+	labels := map[string]string{
+		podSecurityLabelKey + "enforce": level,
+	}
+	next := level
+	switch level {
+	case LevelPrivileged:
+		next = LevelBaseline
+	case LevelBaseline:
+		next = LevelRestricted
+	}
+	labels[podSecurityLabelKey+"warn"] = next
+	labels[podSecurityLabelKey+"audit"] = next
+	return labels
+}
+
+// mapPolicy returns the most restrictive level whose pods the policy admits at most
+func mapPolicy(psp *policyv1beta1.PodSecurityPolicy) PolicyMapping {
+	mapping := PolicyMapping{Name: psp.Name, Level: LevelRestricted}
+	var baseline, restricted []string
+	spec := psp.Spec
+
+	if spec.Privileged {
+		baseline = append(baseline, "allows privileged containers")
+	}
+	if spec.HostNetwork || spec.HostPID || spec.HostIPC {
+		baseline = append(baseline, "allows host namespaces")
+	}
+	if len(spec.HostPorts) > 0 {
+		baseline = append(baseline, "allows host ports")
+	}
+	for _, capability := range spec.AllowedCapabilities {
+		if capability == "*" || !baselineCapabilities.Has(string(capability)) {
+			baseline = append(baseline, fmt.Sprintf("allows adding the %s capability", capability))
+		}
+	}
+	for _, volume := range spec.Volumes {
+		switch {
+		case volume == policyv1beta1.All || volume == policyv1beta1.HostPath:
+			baseline = append(baseline, fmt.Sprintf("allows %s volumes", volume))
+		case !restrictedVolumes.Has(string(volume)):
+			restricted = append(restricted, fmt.Sprintf("allows %s volumes", volume))
+		}
+	}
+	if len(spec.AllowedUnsafeSysctls) > 0 {
+		baseline = append(baseline, "allows unsafe sysctls")
+	}
+
+	if spec.AllowPrivilegeEscalation == nil || *spec.AllowPrivilegeEscalation {
+		restricted = append(restricted, "allows privilege escalation")
+	}
+	if spec.RunAsUser.Rule != policyv1beta1.RunAsUserStrategyMustRunAsNonRoot {
+		restricted = append(restricted, "does not require running as non-root")
+	}
+	dropsAll := false
+	for _, capability := range spec.RequiredDropCapabilities {
+		if capability == "ALL" {
+			dropsAll = true
+		}
+	}
+	if !dropsAll {
+		restricted = append(restricted, "does not require dropping ALL capabilities")
+	}
+	if profiles, found := psp.Annotations["seccomp.security.alpha.kubernetes.io/allowedProfileNames"]; !found || profiles == "*" {
+		restricted = append(restricted, "does not restrict the seccomp profiles")
+	}
+
+	switch {
+	case len(baseline) > 0:
+		mapping.Level = LevelPrivileged
+		mapping.Reasons = baseline
+	case len(restricted) > 0:
+		mapping.Level = LevelBaseline
+		mapping.Reasons = restricted
+	}
+	return mapping
+}
+
+// podSpecOf returns the pod spec of a pod or the pod template of a workload
+func podSpecOf(obj *unstructured.Unstructured) (*corev1.PodSpec, bool) {
+	templatePath, found := podTemplatePaths[obj.GetKind()]
+	if !found {
+		return nil, false
+	}
+	spec, found, _ := unstructured.NestedMap(obj.Object, append(append([]string{}, templatePath...), "spec")...)
+	if !found {
+		return nil, false
+	}
+
+	var podSpec corev1.PodSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &podSpec); err != nil {
+		logrus.Warnf("unable to parse the pod spec of %s %s/%s: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		return nil, false
+	}
+	return &podSpec, true
+}
+
+// checkPodSpec checks a pod spec against the baseline and restricted Pod Security Standards
+func checkPodSpec(spec *corev1.PodSpec) WorkloadLevel {
+	var baseline, restricted []string
+	if spec.HostNetwork || spec.HostPID || spec.HostIPC {
+		baseline = append(baseline, "uses host namespaces")
+	}
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			baseline = append(baseline, fmt.Sprintf("volume %s is a hostPath", volume.Name))
+		}
+		if !isRestrictedVolume(&volume) {
+			restricted = append(restricted, fmt.Sprintf("volume %s is of a restricted type", volume.Name))
+		}
+	}
+
+	podRunAsNonRoot := false
+	podSeccomp := ""
+	if spec.SecurityContext != nil {
+		for _, sysctl := range spec.SecurityContext.Sysctls {
+			if !safeSysctls.Has(sysctl.Name) {
+				baseline = append(baseline, fmt.Sprintf("sets the unsafe sysctl %s", sysctl.Name))
+			}
+		}
+		if spec.SecurityContext.RunAsNonRoot != nil {
+			podRunAsNonRoot = *spec.SecurityContext.RunAsNonRoot
+		}
+		if spec.SecurityContext.RunAsUser != nil && *spec.SecurityContext.RunAsUser == 0 {
+			restricted = append(restricted, "runs as root user")
+		}
+		if spec.SecurityContext.SeccompProfile != nil {
+			podSeccomp = string(spec.SecurityContext.SeccompProfile.Type)
+		}
+	}
+	if podSeccomp == string(corev1.SeccompProfileTypeUnconfined) {
+		baseline = append(baseline, "sets an unconfined seccomp profile")
+	}
+
+	var containers []corev1.Container
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, container := range containers {
+		b, r := checkContainer(&container, podRunAsNonRoot, podSeccomp)
+		baseline = append(baseline, b...)
+		restricted = append(restricted, r...)
+	}
+
+	level := LevelRestricted
+	switch {
+	case len(baseline) > 0:
+		level = LevelPrivileged
+	case len(restricted) > 0:
+		level = LevelBaseline
+	}
+	return WorkloadLevel{
+		Level:                level,
+		BaselineViolations:   baseline,
+		RestrictedViolations: restricted,
+	}
+}
+
+func checkContainer(container *corev1.Container, podRunAsNonRoot bool, podSeccomp string) ([]string, []string) {
+	var baseline, restricted []string
+	for _, port := range container.Ports {
+		if port.HostPort != 0 {
+			baseline = append(baseline, fmt.Sprintf("container %s uses the host port %d", container.Name, port.HostPort))
+		}
+	}
+
+	securityContext := container.SecurityContext
+	if securityContext == nil {
+		securityContext = &corev1.SecurityContext{}
+	}
+	if securityContext.Privileged != nil && *securityContext.Privileged {
+		baseline = append(baseline, fmt.Sprintf("container %s is privileged", container.Name))
+	}
+	if securityContext.ProcMount != nil && *securityContext.ProcMount != corev1.DefaultProcMount {
+		baseline = append(baseline, fmt.Sprintf("container %s sets a non default proc mount", container.Name))
+	}
+
+	dropsAll := false
+	if securityContext.Capabilities != nil {
+		for _, capability := range securityContext.Capabilities.Add {
+			if !baselineCapabilities.Has(string(capability)) {
+				baseline = append(baseline, fmt.Sprintf("container %s adds the %s capability", container.Name, capability))
+			} else if capability != "NET_BIND_SERVICE" {
+				restricted = append(restricted, fmt.Sprintf("container %s adds the %s capability", container.Name, capability))
+			}
+		}
+		for _, capability := range securityContext.Capabilities.Drop {
+			if capability == "ALL" {
+				dropsAll = true
+			}
+		}
+	}
+	if !dropsAll {
+		restricted = append(restricted, fmt.Sprintf("container %s does not drop ALL capabilities", container.Name))
+	}
+
+	seccomp := podSeccomp
+	if securityContext.SeccompProfile != nil {
+		seccomp = string(securityContext.SeccompProfile.Type)
+		if seccomp == string(corev1.SeccompProfileTypeUnconfined) {
+			baseline = append(baseline, fmt.Sprintf("container %s sets an unconfined seccomp profile", container.Name))
+		}
+	}
+	if seccomp != string(corev1.SeccompProfileTypeRuntimeDefault) && seccomp != string(corev1.SeccompProfileTypeLocalhost) {
+		restricted = append(restricted, fmt.Sprintf("container %s does not set the RuntimeDefault or Localhost seccomp profile", container.Name))
+	}
+	if securityContext.AllowPrivilegeEscalation == nil || *securityContext.AllowPrivilegeEscalation {
+		restricted = append(restricted, fmt.Sprintf("container %s allows privilege escalation", container.Name))
+	}
+	runAsNonRoot := podRunAsNonRoot
+	if securityContext.RunAsNonRoot != nil {
+		runAsNonRoot = *securityContext.RunAsNonRoot
+	}
+	if !runAsNonRoot {
+		restricted = append(restricted, fmt.Sprintf("container %s does not set runAsNonRoot", container.Name))
+	}
+	if securityContext.RunAsUser != nil && *securityContext.RunAsUser == 0 {
+		restricted = append(restricted, fmt.Sprintf("container %s runs as root user", container.Name))
+	}
+	return baseline, restricted
+}
+
+func isRestrictedVolume(volume *corev1.Volume) bool {
+	source := volume.VolumeSource
+	return source.ConfigMap != nil || source.CSI != nil || source.DownwardAPI != nil || source.EmptyDir != nil ||
+		source.Ephemeral != nil || source.PersistentVolumeClaim != nil || source.Projected != nil || source.Secret != nil
+}
@@ -0,0 +1,168 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sort"
+	"strings"
+)
+
+var (
+	MutatingWebhookResource   = schema.GroupResource{Group: "admissionregistration.k8s.io", Resource: "mutatingwebhookconfigurations"}
+	ValidatingWebhookResource = schema.GroupResource{Group: "admissionregistration.k8s.io", Resource: "validatingwebhookconfigurations"}
+	APIServiceResource        = schema.GroupResource{Group: "apiregistration.k8s.io", Resource: "apiservices"}
+)
+
+// RegistrationFinding is a webhook or APIService registration that breaks silently on upgrade,
+// either by referencing a removed group/version or by an unavailable APIService backend
+type RegistrationFinding struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Webhook    string `json:"webhook,omitempty"`
+	ApiVersion string `json:"apiVersion,omitempty"`
+	RemovedIn  string `json:"removedIn,omitempty"`
+	Message    string `json:"message"`
+}
+
+// AnalyzeWebhooks flags the rules of the mutating and validating webhook configurations that
+// reference group/versions removed by the target version, any removed one when the target is
+// empty; such rules stop matching after the upgrade and the admission control they implement is
+// silently skipped
+func AnalyzeWebhooks(mutating, validating []unstructured.Unstructured, targetVersion string) []RegistrationFinding {
+	var findings []RegistrationFinding
+	for _, obj := range mutating {
+		var configuration admissionregistrationv1.MutatingWebhookConfiguration
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &configuration); err != nil {
+			logrus.Warnf("unable to parse the mutating webhook configuration %s: %v", obj.GetName(), err)
+			continue
+		}
+		for _, webhook := range configuration.Webhooks {
+			findings = append(findings, analyzeWebhookRules("MutatingWebhookConfiguration", configuration.Name, webhook.Name, webhook.Rules, targetVersion)...)
+		}
+	}
+	for _, obj := range validating {
+		var configuration admissionregistrationv1.ValidatingWebhookConfiguration
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &configuration); err != nil {
+			logrus.Warnf("unable to parse the validating webhook configuration %s: %v", obj.GetName(), err)
+			continue
+		}
+		for _, webhook := range configuration.Webhooks {
+			findings = append(findings, analyzeWebhookRules("ValidatingWebhookConfiguration", configuration.Name, webhook.Name, webhook.Rules, targetVersion)...)
+		}
+	}
+	return findings
+}
+
+func analyzeWebhookRules(kind, name, webhook string, rules []admissionregistrationv1.RuleWithOperations, targetVersion string) []RegistrationFinding {
+	var findings []RegistrationFinding
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		for _, group := range rule.APIGroups {
+			for _, version := range rule.APIVersions {
+				for _, groupVersion := range matchRemovedGroupVersions(group, version, targetVersion) {
+					if seen[groupVersion] {
+						continue
+					}
+					seen[groupVersion] = true
+					findings = append(findings, RegistrationFinding{
+						Kind:       kind,
+						Name:       name,
+						Webhook:    webhook,
+						ApiVersion: groupVersion,
+						RemovedIn:  RemovedGroupVersions[groupVersion],
+						Message: fmt.Sprintf("webhook rules reference %s, which is removed in %s; update the rules to the replacement version or the webhook stops intercepting these requests",
+							groupVersion, RemovedGroupVersions[groupVersion]),
+					})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// matchRemovedGroupVersions returns the group/versions removed by the target version matched by a
+// rule's group and version, expanding the `*` group to every group the version is removed from. A
+// `*` version matches the served versions too, so it is never flagged.
+func matchRemovedGroupVersions(group, version, targetVersion string) []string {
+	if version == "*" {
+		return nil
+	}
+	if group != "*" {
+		if release, found := removedIn(group, version); found && removedBy(release, targetVersion) {
+			if group == "" {
+				return []string{version}
+			}
+			return []string{group + "/" + version}
+		}
+		return nil
+	}
+
+	var groupVersions []string
+	for groupVersion, release := range RemovedGroupVersions {
+		if strings.HasSuffix(groupVersion, "/"+version) && removedBy(release, targetVersion) {
+			groupVersions = append(groupVersions, groupVersion)
+		}
+	}
+	sort.Strings(groupVersions)
+	return groupVersions
+}
+
+// AnalyzeAPIServices flags the APIService registrations of the group/versions removed by the target
+// version, any removed one when the target is empty, that are served by an aggregated API server,
+// along with the registrations whose backend is not available
+func AnalyzeAPIServices(apiServices []unstructured.Unstructured, targetVersion string) []RegistrationFinding {
+	var findings []RegistrationFinding
+	for _, obj := range apiServices {
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		version, _, _ := unstructured.NestedString(obj.Object, "spec", "version")
+		service, aggregated, _ := unstructured.NestedMap(obj.Object, "spec", "service")
+		groupVersion := version
+		if group != "" {
+			groupVersion = group + "/" + version
+		}
+
+		// the local registrations of the built-in APIs go away along with the upgrade
+		if release, found := removedIn(group, version); found && removedBy(release, targetVersion) && aggregated && service != nil {
+			findings = append(findings, RegistrationFinding{
+				Kind:       "APIService",
+				Name:       obj.GetName(),
+				ApiVersion: groupVersion,
+				RemovedIn:  release,
+				Message:    fmt.Sprintf("an aggregated API server is registered for %s, which is removed in %s", groupVersion, release),
+			})
+		}
+
+		if available, message := apiServiceAvailability(&obj); !available {
+			findings = append(findings, RegistrationFinding{
+				Kind:       "APIService",
+				Name:       obj.GetName(),
+				ApiVersion: groupVersion,
+				Message:    fmt.Sprintf("the backend of %s is not available: %s", groupVersion, message),
+			})
+		}
+	}
+	return findings
+}
+
+// apiServiceAvailability reads the Available condition of an APIService
+func apiServiceAvailability(obj *unstructured.Unstructured) (bool, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Available" {
+			continue
+		}
+		if condition["status"] == "True" {
+			return true, ""
+		}
+		reason, _ := condition["reason"].(string)
+		message, _ := condition["message"].(string)
+		return false, strings.TrimSpace(reason + " " + message)
+	}
+	// no condition reported yet
+	return true, ""
+}
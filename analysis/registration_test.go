@@ -0,0 +1,28 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchRemovedGroupVersions(t *testing.T) {
+	tests := []struct {
+		group, version, targetVersion string
+		want                          []string
+	}{
+		{group: "autoscaling", version: "v2beta2", want: []string{"autoscaling/v2beta2"}},
+		{group: "autoscaling", version: "v2beta2", targetVersion: "1.25", want: nil},
+		{group: "autoscaling", version: "v2beta2", targetVersion: "1.26", want: []string{"autoscaling/v2beta2"}},
+		{group: "autoscaling", version: "v2beta2", targetVersion: "1.27.3", want: []string{"autoscaling/v2beta2"}},
+		{group: "autoscaling", version: "v2", targetVersion: "1.27", want: nil},
+		{group: "*", version: "v1beta2", want: []string{"apps/v1beta2", "flowcontrol.apiserver.k8s.io/v1beta2"}},
+		{group: "*", version: "v1beta2", targetVersion: "1.26", want: []string{"apps/v1beta2"}},
+		{group: "*", version: "*", want: nil},
+	}
+	for _, test := range tests {
+		got := matchRemovedGroupVersions(test.group, test.version, test.targetVersion)
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("matchRemovedGroupVersions(%s, %s, %s) = %v, want %v", test.group, test.version, test.targetVersion, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import utilversion "k8s.io/apimachinery/pkg/util/version"
+
+// RemovedGroupVersions maps the built-in group/versions that are no longer served to the
+// Kubernetes release removing the last of their kinds
+var RemovedGroupVersions = map[string]string{
+	"apps/v1beta1":                         "1.16",
+	"apps/v1beta2":                         "1.16",
+	"extensions/v1beta1":                   "1.22",
+	"networking.k8s.io/v1beta1":            "1.22",
+	"admissionregistration.k8s.io/v1beta1": "1.22",
+	"apiextensions.k8s.io/v1beta1":         "1.22",
+	"apiregistration.k8s.io/v1beta1":       "1.22",
+	"authentication.k8s.io/v1beta1":        "1.22",
+	"authorization.k8s.io/v1beta1":         "1.22",
+	"certificates.k8s.io/v1beta1":          "1.22",
+	"coordination.k8s.io/v1beta1":          "1.22",
+	"rbac.authorization.k8s.io/v1beta1":    "1.22",
+	"scheduling.k8s.io/v1beta1":            "1.22",
+	"batch/v1beta1":                        "1.25",
+	"discovery.k8s.io/v1beta1":             "1.25",
+	"events.k8s.io/v1beta1":                "1.25",
+	"autoscaling/v2beta1":                  "1.25",
+	"policy/v1beta1":                       "1.25",
+	"node.k8s.io/v1beta1":                  "1.25",
+	"flowcontrol.apiserver.k8s.io/v1beta1": "1.26",
+	"autoscaling/v2beta2":                  "1.26",
+	"storage.k8s.io/v1beta1":               "1.27",
+	"flowcontrol.apiserver.k8s.io/v1beta2": "1.29",
+}
+
+// removedIn returns the release removing the given group and version, the core group being empty
+func removedIn(group, version string) (string, bool) {
+	groupVersion := version
+	if group != "" {
+		groupVersion = group + "/" + version
+	}
+	release, found := RemovedGroupVersions[groupVersion]
+	return release, found
+}
+
+// removedBy tells whether the removal release is reached by the target version, every removal
+// counting when the target is empty
+func removedBy(release, targetVersion string) bool {
+	if targetVersion == "" {
+		return true
+	}
+	removal, err := utilversion.ParseGeneric(release)
+	if err != nil {
+		return false
+	}
+	target, err := utilversion.ParseGeneric(targetVersion)
+	return err == nil && target.AtLeast(removal)
+}
@@ -0,0 +1,105 @@
+package argoapi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client reads the clusters, the applications and their managed resources from the ArgoCD API
+// server, authenticated with the token of an ArgoCD account
+type Client struct {
+	server     *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+// managedResourcesResponse is the response of the managed-resources API
+type managedResourcesResponse struct {
+	Items []argoAppV1.ResourceDiff `json:"items"`
+}
+
+// NewClient returns a client of the ArgoCD API server at the given URL; plain http is accepted
+// for a local stand-in of the API server
+func NewClient(server, token string, insecure bool) (*Client, error) {
+	serverURL, err := url.Parse(strings.TrimRight(server, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid argocd server url %s: %v", server, err)
+	}
+	if serverURL.Scheme != "http" && serverURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid argocd server url %s: the scheme has to be http or https", server)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	return &Client{
+		server:     serverURL,
+		token:      token,
+		httpClient: &http.Client{Transport: transport, Timeout: time.Minute},
+	}, nil
+}
+
+// ListClusters lists the clusters known to ArgoCD, without their credentials
+func (c *Client) ListClusters(ctx context.Context) ([]argoAppV1.Cluster, error) {
+	var clusters argoAppV1.ClusterList
+	if err := c.get(ctx, "/api/v1/clusters", nil, &clusters); err != nil {
+		return nil, err
+	}
+	return clusters.Items, nil
+}
+
+// ListApplications lists the applications the account can see, in every application namespace
+func (c *Client) ListApplications(ctx context.Context) ([]argoAppV1.Application, error) {
+	var applications argoAppV1.ApplicationList
+	if err := c.get(ctx, "/api/v1/applications", nil, &applications); err != nil {
+		return nil, err
+	}
+	return applications.Items, nil
+}
+
+// ManagedResources returns the target and the live state of the resources managed by the application
+func (c *Client) ManagedResources(ctx context.Context, application *argoAppV1.Application) ([]argoAppV1.ResourceDiff, error) {
+	query := url.Values{}
+	if application.Namespace != "" {
+		query.Set("appNamespace", application.Namespace)
+	}
+	var resources managedResourcesResponse
+	if err := c.get(ctx, "/api/v1/applications/"+url.PathEscape(application.Name)+"/managed-resources", query, &resources); err != nil {
+		return nil, err
+	}
+	return resources.Items, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, into interface{}) error {
+	endpoint := *c.server
+	endpoint.Path += path
+	endpoint.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("argocd api request %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("argocd api request %s failed with %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("unable to parse the argocd api response of %s: %v", path, err)
+	}
+	return nil
+}
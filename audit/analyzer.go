@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"io"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Finding is a deprecated API called by the clients as seen in the audit logs of a cluster
+type Finding struct {
+	ApiVersion  string   `json:"apiVersion"`
+	Kind        string   `json:"kind"`
+	Resource    string   `json:"resource"`
+	RuleSet     string   `json:"ruleSet,omitempty"`
+	ReplaceWith string   `json:"replaceWith,omitempty"`
+	Since       string   `json:"since,omitempty"`
+	Count       int      `json:"count"`
+	Clients     []Client `json:"clients"`
+}
+
+// Client is a caller of a deprecated API
+type Client struct {
+	User      string `json:"user"`
+	UserAgent string `json:"userAgent"`
+	Verb      string `json:"verb"`
+	Count     int    `json:"count"`
+}
+
+type apiKey struct {
+	apiVersion string
+	resource   string
+}
+
+type clientKey struct {
+	user      string
+	userAgent string
+	verb      string
+}
+
+// Analyzer aggregates the audit events per cluster and judges the called APIs against
+// the same rule set as the collected objects
+type Analyzer struct {
+	judge judge.Judge
+	kinds map[schema.GroupVersionResource]string
+
+	mu       sync.Mutex
+	calls    map[string]map[apiKey]map[clientKey]int
+	verdicts map[apiKey]*judge.Result
+}
+
+func NewAnalyzer(ruleJudge judge.Judge) *Analyzer {
+	return &Analyzer{
+		judge:    ruleJudge,
+		kinds:    knownKinds(),
+		calls:    make(map[string]map[apiKey]map[clientKey]int),
+		verdicts: make(map[apiKey]*judge.Result),
+	}
+}
+
+// Ingest adds the events of the audit log read from r to the given cluster's report
+// and returns the number of events ingested. The log is read before taking the lock, a slow
+// upload doesn't hold the reports up. Nothing is added when the log can't be read or its APIs
+// can't be judged, so that the log can be ingested again.
+func (a *Analyzer) Ingest(clusterName string, r io.Reader) (int, error) {
+	calls := make(map[apiKey]map[clientKey]int)
+	count, err := ReadEvents(r, func(event Event) {
+		api := apiKey{apiVersion: event.ObjectRef.groupVersion(), resource: event.ObjectRef.Resource}
+		clients, found := calls[api]
+		if !found {
+			clients = make(map[clientKey]int)
+			calls[api] = clients
+		}
+		clients[clientKey{user: event.User.Username, userAgent: event.UserAgent, verb: event.Verb}]++
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if unjudged := a.unjudged(calls); len(unjudged) > 0 {
+		if err := a.judgeAPIs(unjudged); err != nil {
+			return 0, err
+		}
+	}
+	a.merge(clusterName, calls)
+	return count, nil
+}
+
+// unjudged returns the called APIs without a verdict yet
+func (a *Analyzer) unjudged(calls map[apiKey]map[clientKey]int) map[apiKey]struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	unjudged := make(map[apiKey]struct{})
+	for api := range calls {
+		if _, judged := a.verdicts[api]; !judged {
+			unjudged[api] = struct{}{}
+		}
+	}
+	return unjudged
+}
+
+// merge adds the calls to the cluster's report
+func (a *Analyzer) merge(clusterName string, calls map[apiKey]map[clientKey]int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	clusterCalls, found := a.calls[clusterName]
+	if !found {
+		clusterCalls = make(map[apiKey]map[clientKey]int)
+		a.calls[clusterName] = clusterCalls
+	}
+	for api, clients := range calls {
+		merged, found := clusterCalls[api]
+		if !found {
+			merged = make(map[clientKey]int)
+			clusterCalls[api] = merged
+		}
+		for client, count := range clients {
+			merged[client] += count
+		}
+	}
+}
+
+// Report returns the deprecated APIs called in the given cluster, the most called first
+func (a *Analyzer) Report(clusterName string) []Finding {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	findings := []Finding{}
+	for api, clients := range a.calls[clusterName] {
+		verdict := a.verdicts[api]
+		if verdict == nil {
+			continue
+		}
+		finding := Finding{
+			ApiVersion:  api.apiVersion,
+			Kind:        verdict.Kind,
+			Resource:    api.resource,
+			RuleSet:     verdict.RuleSet,
+			ReplaceWith: verdict.ReplaceWith,
+		}
+		if verdict.Since != nil {
+			finding.Since = verdict.Since.String()
+		}
+		for client, count := range clients {
+			finding.Count += count
+			finding.Clients = append(finding.Clients, Client{
+				User:      client.user,
+				UserAgent: client.userAgent,
+				Verb:      client.verb,
+				Count:     count,
+			})
+		}
+		sort.Slice(finding.Clients, func(i, j int) bool {
+			return finding.Clients[i].Count > finding.Clients[j].Count
+		})
+		findings = append(findings, finding)
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Count > findings[j].Count
+	})
+	return findings
+}
+
+// Clusters returns the names of the clusters audit logs were ingested for
+func (a *Analyzer) Clusters() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var clusters []string
+	for clusterName := range a.calls {
+		clusters = append(clusters, clusterName)
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+// judgeAPIs evaluates the rules against a stub manifest of every API and remembers the
+// verdicts; APIs with unknown kinds can't be matched by the rules and count as not deprecated.
+// The rules are evaluated without the lock, the reports stay available meanwhile.
+func (a *Analyzer) judgeAPIs(apis map[apiKey]struct{}) error {
+	verdicts := make(map[apiKey]*judge.Result, len(apis))
+	var manifests []map[string]interface{}
+	byKind := make(map[string]apiKey)
+	for api := range apis {
+		verdicts[api] = nil
+		gv, err := schema.ParseGroupVersion(api.apiVersion)
+		if err != nil {
+			continue
+		}
+		kind, found := a.kinds[gv.WithResource(api.resource)]
+		if !found {
+			continue
+		}
+		byKind[api.apiVersion+"/"+kind] = api
+		manifests = append(manifests, map[string]interface{}{
+			"apiVersion": api.apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name": api.resource,
+			},
+		})
+	}
+
+	if len(manifests) > 0 {
+		results, err := a.judge.Eval(manifests)
+		if err != nil {
+			// left unjudged, these are judged again when the log is ingested again
+			return fmt.Errorf("failed to evaluate the audited apis: %w", err)
+		}
+		for i := range results {
+			if api, found := byKind[results[i].ApiVersion+"/"+results[i].Kind]; found {
+				verdicts[api] = &results[i]
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for api, verdict := range verdicts {
+		a.verdicts[api] = verdict
+	}
+	return nil
+}
+
+// knownKinds maps the resources of the built-in APIs, including the deprecated versions
+// still known to client-go, to their kinds
+func knownKinds() map[schema.GroupVersionResource]string {
+	kinds := map[schema.GroupVersionResource]string{
+		{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"}: "CustomResourceDefinition",
+		{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}:      "CustomResourceDefinition",
+		{Group: "apiregistration.k8s.io", Version: "v1beta1", Resource: "apiservices"}:             "APIService",
+		{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}:                  "APIService",
+	}
+	for gvk := range scheme.Scheme.AllKnownTypes() {
+		if strings.HasSuffix(gvk.Kind, "List") || strings.HasSuffix(gvk.Kind, "Options") {
+			continue
+		}
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		if _, found := kinds[plural]; !found {
+			kinds[plural] = gvk.Kind
+		}
+	}
+	return kinds
+}
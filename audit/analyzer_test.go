@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+)
+
+// fakeJudge flags the manifests of the deprecated apiVersions, failing while err is set
+type fakeJudge struct {
+	deprecated map[string]string
+	err        error
+	evaluated  int
+}
+
+func (j *fakeJudge) Eval(manifests []map[string]interface{}) ([]judge.Result, error) {
+	if j.err != nil {
+		return nil, j.err
+	}
+	var results []judge.Result
+	for _, manifest := range manifests {
+		j.evaluated++
+		apiVersion := manifest["apiVersion"].(string)
+		if replaceWith, found := j.deprecated[apiVersion]; found {
+			results = append(results, judge.Result{
+				Name:        manifest["metadata"].(map[string]interface{})["name"].(string),
+				Kind:        manifest["kind"].(string),
+				ApiVersion:  apiVersion,
+				RuleSet:     "Deprecated APIs",
+				ReplaceWith: replaceWith,
+			})
+		}
+	}
+	return results, nil
+}
+
+func newFakeJudge() *fakeJudge {
+	return &fakeJudge{deprecated: map[string]string{
+		"extensions/v1beta1": "networking.k8s.io/v1",
+		"policy/v1beta1":     "N/A",
+	}}
+}
+
+func TestAnalyzerIngest(t *testing.T) {
+	analyzer := NewAnalyzer(newFakeJudge())
+	log := strings.Join([]string{
+		auditEvent("ResponseComplete", "ci", "list", "extensions/v1beta1", "ingresses"),
+		auditEvent("ResponseComplete", "ci", "list", "extensions/v1beta1", "ingresses"),
+		auditEvent("ResponseComplete", "admin", "get", "extensions/v1beta1", "ingresses"),
+		auditEvent("ResponseComplete", "ci", "create", "policy/v1beta1", "podsecuritypolicies"),
+		auditEvent("ResponseComplete", "ci", "list", "networking.k8s.io/v1", "ingresses"),
+		auditEvent("ResponseComplete", "ci", "list", "example.com/v1", "widgets"),
+	}, "\n")
+	for _, clusterName := range []string{"prod", "prod", "staging"} {
+		if _, err := analyzer.Ingest(clusterName, strings.NewReader(log)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if clusters := analyzer.Clusters(); strings.Join(clusters, ",") != "prod,staging" {
+		t.Errorf("got the clusters %v", clusters)
+	}
+	findings := analyzer.Report("prod")
+	if len(findings) != 2 {
+		t.Fatalf("got %d findings, want 2: %+v", len(findings), findings)
+	}
+	ingresses := findings[0]
+	if ingresses.ApiVersion != "extensions/v1beta1" || ingresses.Kind != "Ingress" || ingresses.Resource != "ingresses" ||
+		ingresses.ReplaceWith != "networking.k8s.io/v1" || ingresses.Count != 6 {
+		t.Errorf("unexpected ingress finding %+v", ingresses)
+	}
+	if len(ingresses.Clients) != 2 || ingresses.Clients[0].User != "ci" || ingresses.Clients[0].Count != 4 ||
+		ingresses.Clients[1].User != "admin" || ingresses.Clients[1].Verb != "get" || ingresses.Clients[1].Count != 2 {
+		t.Errorf("unexpected ingress clients %+v", ingresses.Clients)
+	}
+	if psps := findings[1]; psps.Kind != "PodSecurityPolicy" || psps.Count != 2 {
+		t.Errorf("unexpected podsecuritypolicy finding %+v", psps)
+	}
+	if findings := analyzer.Report("dev"); len(findings) != 0 {
+		t.Errorf("got the findings %+v of a cluster without audit logs", findings)
+	}
+}
+
+func TestAnalyzerIngestJudgeFailure(t *testing.T) {
+	fakeJudge := newFakeJudge()
+	fakeJudge.err = errors.New("rules unavailable")
+	analyzer := NewAnalyzer(fakeJudge)
+	log := auditEvent("ResponseComplete", "ci", "list", "extensions/v1beta1", "ingresses")
+
+	// nothing is ingested while the apis can't be judged, the log is ingested again afterwards
+	if count, err := analyzer.Ingest("prod", strings.NewReader(log)); err == nil || count != 0 {
+		t.Errorf("got %d events ingested, %v, want an error", count, err)
+	}
+	if findings := analyzer.Report("prod"); len(findings) != 0 {
+		t.Errorf("got the findings %+v of a failed ingestion", findings)
+	}
+	fakeJudge.err = nil
+	for i := 0; i < 2; i++ {
+		if count, err := analyzer.Ingest("prod", strings.NewReader(log)); err != nil || count != 1 {
+			t.Fatalf("got %d events ingested: %v", count, err)
+		}
+	}
+	if findings := analyzer.Report("prod"); len(findings) != 1 || findings[0].Count != 2 {
+		t.Errorf("unexpected findings %+v", findings)
+	}
+	// the verdicts are remembered
+	if fakeJudge.evaluated != 1 {
+		t.Errorf("the apis were judged %d times, want 1", fakeJudge.evaluated)
+	}
+}
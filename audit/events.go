@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+)
+
+// Event is the subset of an audit.k8s.io/v1 Event needed to find the clients calling deprecated APIs
+type Event struct {
+	Stage     string           `json:"stage"`
+	Verb      string           `json:"verb"`
+	UserAgent string           `json:"userAgent"`
+	User      UserInfo         `json:"user"`
+	ObjectRef *ObjectReference `json:"objectRef,omitempty"`
+}
+
+type UserInfo struct {
+	Username string `json:"username"`
+}
+
+type ObjectReference struct {
+	Resource    string `json:"resource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+	APIGroup    string `json:"apiGroup,omitempty"`
+	APIVersion  string `json:"apiVersion,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// groupVersion returns the apiVersion of the referenced object in the manifest form
+func (o *ObjectReference) groupVersion() string {
+	if o.APIGroup == "" {
+		return o.APIVersion
+	}
+	return o.APIGroup + "/" + o.APIVersion
+}
+
+// ReadEvents decodes an audit log in the JSON lines form and calls fn for every event of a
+// request on a resource. Events of the intermediate stages are skipped so that every request
+// counts once, and so are the lines that aren't JSON events, e.g. a line cut by a crash of the
+// API server. It returns the number of events passed on to fn.
+func ReadEvents(r io.Reader, fn func(Event)) (int, error) {
+	count := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			logrus.Warnf("skipping the audit event on line %d: %v", lineNo, err)
+			continue
+		}
+		if event.ObjectRef == nil || event.ObjectRef.APIVersion == "" || event.ObjectRef.Resource == "" {
+			continue
+		}
+		if event.Stage != "" && event.Stage != "ResponseComplete" && event.Stage != "Panic" {
+			continue
+		}
+		fn(event)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read the audit log: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+)
+
+// auditEvent returns an audit event line of a request of the user on the resource of the group version
+func auditEvent(stage, user, verb, groupVersion, resource string) string {
+	group, version := "", groupVersion
+	if i := strings.Index(groupVersion, "/"); i >= 0 {
+		group, version = groupVersion[:i], groupVersion[i+1:]
+	}
+	return `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","stage":"` + stage +
+		`","verb":"` + verb + `","userAgent":"kubectl/v1.21.0","user":{"username":"` + user +
+		`"},"objectRef":{"resource":"` + resource + `","namespace":"shop","apiGroup":"` + group +
+		`","apiVersion":"` + version + `"}}`
+}
+
+func TestReadEvents(t *testing.T) {
+	ingress := auditEvent("ResponseComplete", "ci", "list", "extensions/v1beta1", "ingresses")
+	tests := []struct {
+		name      string
+		log       string
+		wantUsers []string
+	}{
+		{
+			name:      "every stage",
+			log:       strings.Join([]string{auditEvent("RequestReceived", "ci", "list", "extensions/v1beta1", "ingresses"), ingress, auditEvent("Panic", "admin", "get", "v1", "pods")}, "\n"),
+			wantUsers: []string{"ci", "admin"},
+		},
+		{
+			name:      "no stage",
+			log:       auditEvent("", "ci", "create", "policy/v1beta1", "podsecuritypolicies"),
+			wantUsers: []string{"ci"},
+		},
+		{
+			name:      "no resource",
+			log:       `{"stage":"ResponseComplete","verb":"get","user":{"username":"probe"},"requestURI":"/healthz"}` + "\n" + ingress,
+			wantUsers: []string{"ci"},
+		},
+		{
+			name:      "blank lines",
+			log:       "\n" + ingress + "\n\n  \n" + ingress + "\n",
+			wantUsers: []string{"ci", "ci"},
+		},
+		{
+			name:      "bad line mid-file",
+			log:       ingress + "\n" + `{"stage":"ResponseComplete","verb":"li` + "\nnot json\n" + auditEvent("ResponseComplete", "admin", "get", "v1", "pods"),
+			wantUsers: []string{"ci", "admin"},
+		},
+	}
+	for _, test := range tests {
+		var users []string
+		count, err := ReadEvents(strings.NewReader(test.log), func(event Event) {
+			users = append(users, event.User.Username)
+		})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if count != len(test.wantUsers) || strings.Join(users, ",") != strings.Join(test.wantUsers, ",") {
+			t.Errorf("%s: got %d events of %v, want %v", test.name, count, users, test.wantUsers)
+		}
+	}
+}
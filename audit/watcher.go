@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Watcher polls a directory of audit logs laid out as `<dir>/<clusterName>/*.log` and ingests the
+// lines appended since the previous poll. Truncated or rotated files are read again from the start.
+// The directories of unknown clusters are left alone until the cluster is known.
+type Watcher struct {
+	dir      string
+	interval time.Duration
+	analyzer *Analyzer
+	// resolve returns the name of the known cluster of a directory
+	resolve func(dirName string) (string, error)
+	offsets map[string]fileOffset
+	// unknown keeps the directories of unknown clusters already warned about
+	unknown map[string]bool
+}
+
+// fileOffset is the part of a file ingested so far, along with the file it was read from to
+// tell a rotated file apart
+type fileOffset struct {
+	file   os.FileInfo
+	offset int64
+}
+
+func NewWatcher(dir string, interval time.Duration, analyzer *Analyzer, resolve func(dirName string) (string, error)) *Watcher {
+	return &Watcher{
+		dir:      dir,
+		interval: interval,
+		analyzer: analyzer,
+		resolve:  resolve,
+		offsets:  make(map[string]fileOffset),
+		unknown:  make(map[string]bool),
+	}
+}
+
+// Run polls the directory until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	logrus.Infof("watching the audit logs under %s every %v", w.dir, w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.poll()
+		select {
+		case <-ctx.Done():
+			logrus.Info("stopping the audit log watcher")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) poll() {
+	clusterDirs, err := os.ReadDir(w.dir)
+	if err != nil {
+		logrus.Errorf("unable to read the audit log directory %s: %v", w.dir, err)
+		return
+	}
+	for _, clusterDir := range clusterDirs {
+		if !clusterDir.IsDir() {
+			continue
+		}
+		clusterName, err := w.resolve(clusterDir.Name())
+		if err != nil {
+			if !w.unknown[clusterDir.Name()] {
+				logrus.Warnf("skipping the audit logs of the %s directory: %v", clusterDir.Name(), err)
+				w.unknown[clusterDir.Name()] = true
+			}
+			continue
+		}
+		delete(w.unknown, clusterDir.Name())
+
+		logFiles, err := filepath.Glob(filepath.Join(w.dir, clusterDir.Name(), "*.log"))
+		if err != nil {
+			logrus.Errorf("unable to list the audit logs of the %s cluster: %v", clusterName, err)
+			continue
+		}
+		for _, logFile := range logFiles {
+			if err := w.ingestFile(clusterName, logFile); err != nil {
+				logrus.Errorf("unable to ingest the audit log %s: %v", logFile, err)
+			}
+		}
+	}
+}
+
+// ingestFile ingests the complete lines written to the file since the last poll
+func (w *Watcher) ingestFile(clusterName, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	previous, found := w.offsets[path]
+	offset := previous.offset
+	switch {
+	case found && !os.SameFile(previous.file, info):
+		logrus.Infof("audit log %s was rotated, reading it from the start", path)
+		offset = 0
+	case info.Size() < offset:
+		logrus.Infof("audit log %s was truncated, reading it from the start", path)
+		offset = 0
+	}
+	if info.Size() == offset {
+		return nil
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	// leave a partially written line for the next poll
+	end := bytes.LastIndexByte(content, '\n')
+	if end < 0 {
+		return nil
+	}
+	count, err := w.analyzer.Ingest(clusterName, bytes.NewReader(content[:end+1]))
+	if err != nil {
+		// the lines are read again with the next poll
+		return err
+	}
+	w.offsets[path] = fileOffset{file: info, offset: offset + int64(end) + 1}
+	logrus.Debugf("ingested %d audit events of the %s cluster from %s", count, clusterName, path)
+	return nil
+}
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendLog(t *testing.T, path, content string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ingressCount(analyzer *Analyzer, clusterName string) int {
+	for _, finding := range analyzer.Report(clusterName) {
+		if finding.Resource == "ingresses" {
+			return finding.Count
+		}
+	}
+	return 0
+}
+
+func TestWatcherPoll(t *testing.T) {
+	dir := t.TempDir()
+	for _, clusterDir := range []string{"prod", "unknown"} {
+		if err := os.Mkdir(filepath.Join(dir, clusterDir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeJudge := newFakeJudge()
+	analyzer := NewAnalyzer(fakeJudge)
+	watcher := NewWatcher(dir, 0, analyzer, func(dirName string) (string, error) {
+		if dirName != "prod" {
+			return "", fmt.Errorf("%s not found", dirName)
+		}
+		return dirName, nil
+	})
+	prodLog := filepath.Join(dir, "prod", "audit.log")
+	ingress := auditEvent("ResponseComplete", "ci", "list", "extensions/v1beta1", "ingresses")
+	appendLog(t, filepath.Join(dir, "unknown", "audit.log"), ingress+"\n")
+
+	tests := []struct {
+		name   string
+		before func()
+		want   int
+	}{
+		{
+			name:   "complete lines",
+			before: func() { appendLog(t, prodLog, ingress+"\n"+ingress+"\n") },
+			want:   2,
+		},
+		{
+			name:   "nothing new",
+			before: func() {},
+			want:   2,
+		},
+		{
+			name:   "partially written line",
+			before: func() { appendLog(t, prodLog, ingress+"\n"+ingress[:20]) },
+			want:   3,
+		},
+		{
+			name:   "rest of the line and a bad line",
+			before: func() { appendLog(t, prodLog, ingress[20:]+"\nnot json\n"+ingress+"\n") },
+			want:   5,
+		},
+		{
+			name: "failed ingestion",
+			before: func() {
+				fakeJudge.err = fmt.Errorf("rules unavailable")
+				appendLog(t, prodLog, auditEvent("ResponseComplete", "ci", "create", "policy/v1beta1", "podsecuritypolicies")+"\n"+ingress+"\n")
+			},
+			want: 5,
+		},
+		{
+			name:   "ingestion resumed",
+			before: func() { fakeJudge.err = nil },
+			want:   6,
+		},
+		{
+			name: "truncated",
+			before: func() {
+				if err := os.WriteFile(prodLog, []byte(ingress+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: 7,
+		},
+		{
+			name: "rotated",
+			before: func() {
+				if err := os.Rename(prodLog, prodLog+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendLog(t, prodLog, ingress+"\n"+ingress+"\n")
+			},
+			want: 9,
+		},
+	}
+	for _, test := range tests {
+		test.before()
+		watcher.poll()
+		if got := ingressCount(analyzer, "prod"); got != test.want {
+			t.Errorf("%s: got %d ingress calls, want %d", test.name, got, test.want)
+		}
+	}
+	if clusters := analyzer.Clusters(); len(clusters) != 1 {
+		t.Errorf("got the audit logs of the %v clusters, want prod only", clusters)
+	}
+}
@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/argoapi"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"strings"
+)
+
+// ArgoAPICollector collects the resources ArgoCD deploys to a cluster through the managed-resources
+// API of the ArgoCD API server, without any credentials of the cluster. The desired manifests of
+// the applications are judged, the live objects are kept for the analyses.
+type ArgoAPICollector struct {
+	*commonCollector
+	client           *argoapi.Client
+	cluster          argoAppV1.Cluster
+	namespaces       []string
+	clusterResources bool
+	labelSelector    string
+	selector         labels.Selector
+	retainResources  sets.String
+	retained         map[string][]unstructured.Unstructured
+}
+
+func NewArgoAPICollector(client *argoapi.Client, cluster *argoAppV1.Cluster, opts *ClusterOpts) (*ArgoAPICollector, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %s: %w", opts.LabelSelector, err)
+	}
+	collector := &ArgoAPICollector{
+		commonCollector:  newCommonCollector(config.ArgoAPICollectorName),
+		client:           client,
+		cluster:          *cluster,
+		namespaces:       opts.Namespaces,
+		clusterResources: opts.ClusterResources,
+		labelSelector:    opts.LabelSelector,
+		selector:         selector,
+		retainResources:  sets.NewString(),
+		retained:         make(map[string][]unstructured.Unstructured),
+	}
+	for _, gr := range opts.RetainResources {
+		collector.retainResources.Insert(gr.String())
+	}
+	return collector, nil
+}
+
+func (c *ArgoAPICollector) Get(ctx context.Context) ([]map[string]interface{}, error) {
+	applications, err := c.client.ListApplications(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []map[string]interface{}
+	c.retained = make(map[string][]unstructured.Unstructured)
+	for i := range applications {
+		if !c.deploysTo(&applications[i]) {
+			continue
+		}
+		log.Debug().Msgf("Retrieving the managed resources of the %s/%s application", applications[i].Namespace, applications[i].Name)
+		resources, err := c.client.ManagedResources(ctx, &applications[i])
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Debug().Msgf("Failed to retrieve the managed resources of %s: %s", applications[i].Name, err)
+			continue
+		}
+		for _, resource := range resources {
+			if !c.inScope(resource.Namespace) {
+				continue
+			}
+			if manifest := parseState(resource.TargetState); manifest != nil && c.selector.Matches(labels.Set(manifest.GetLabels())) {
+				results = append(results, manifest.Object)
+			}
+			live := parseState(resource.LiveState)
+			if live == nil || !c.selector.Matches(labels.Set(live.GetLabels())) {
+				continue
+			}
+			gvr, _ := meta.UnsafeGuessKindToResource(live.GroupVersionKind())
+			if gr := gvr.GroupResource().String(); c.retainResources.Has(gr) {
+				c.retained[gr] = append(c.retained[gr], *live)
+			}
+		}
+	}
+	return results, nil
+}
+
+// GetServerVersion returns the server version ArgoCD last saw for the cluster
+func (c *ArgoAPICollector) GetServerVersion(_ context.Context) (*judge.Version, error) {
+	if c.cluster.ServerVersion == "" {
+		return nil, fmt.Errorf("the server version of %s is not known to argocd yet: %s", c.cluster.Name, c.cluster.ConnectionState.Message)
+	}
+	return judge.NewVersion(c.cluster.ServerVersion)
+}
+
+// Objects returns the live objects of a retained group-resource collected by the last Get
+func (c *ArgoAPICollector) Objects(gr schema.GroupResource) []unstructured.Unstructured {
+	return c.retained[gr.String()]
+}
+
+// CountObjects isn't supported, the API server only knows about the resources managed by ArgoCD
+func (c *ArgoAPICollector) CountObjects(_ context.Context, gvr schema.GroupVersionResource, _ bool) (int64, error) {
+	return 0, fmt.Errorf("the objects of %s can't be counted through the argocd api server", gvr.GroupResource())
+}
+
+// Scope reports which part of the cluster the collector scans
+func (c *ArgoAPICollector) Scope() config.ScanScope {
+	return config.ScanScope{
+		Namespaced:       len(c.namespaces) > 0,
+		Namespaces:       c.namespaces,
+		ClusterResources: len(c.namespaces) == 0 || c.clusterResources,
+		LabelSelector:    c.labelSelector,
+	}
+}
+
+// deploysTo tells whether the application deploys to the cluster of the collector
+func (c *ArgoAPICollector) deploysTo(application *argoAppV1.Application) bool {
+	destination := application.Spec.Destination
+	if destination.Name != "" {
+		return destination.Name == c.cluster.Name
+	}
+	return strings.TrimRight(destination.Server, "/") == strings.TrimRight(c.cluster.Server, "/")
+}
+
+// inScope tells whether the resources of the namespace, cluster-scoped when empty, are scanned
+func (c *ArgoAPICollector) inScope(namespace string) bool {
+	if len(c.namespaces) == 0 {
+		return true
+	}
+	if namespace == "" {
+		return c.clusterResources
+	}
+	for _, ns := range c.namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// parseState parses a state of the managed-resources API, nil for the missing ones
+func parseState(state string) *unstructured.Unstructured {
+	if state == "" || state == "null" {
+		return nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(state), &object); err != nil {
+		log.Warn().Msgf("failed to parse the state of a managed resource: %v", err)
+		return nil
+	}
+	if object == nil {
+		return nil
+	}
+	return &unstructured.Unstructured{Object: object}
+}
@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/gkarthiks/argo-apid-helper/argoapi"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const fakeArgoToken = "argocd-token"
+
+// fakeArgoServer serves the clusters, the applications and their managed resources the way the
+// ArgoCD API server does; managedResources is keyed by <app namespace>/<app name>
+func fakeArgoServer(t *testing.T, clusters, applications string, managedResources map[string]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/clusters", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(clusters))
+	})
+	mux.HandleFunc("/api/v1/applications", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(applications))
+	})
+	mux.HandleFunc("/api/v1/applications/", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[len("/api/v1/applications/") : len(r.URL.Path)-len("/managed-resources")]
+		key := r.URL.Query().Get("appNamespace") + "/" + name
+		resources, found := managedResources[key]
+		if !found {
+			t.Errorf("unexpected managed-resources request of %s", key)
+			http.Error(w, "application not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(resources))
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fakeArgoToken {
+			http.Error(w, "no session information", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// managedResource returns a resource of the managed-resources API, the states being given as JSON
+func managedResource(group, kind, namespace, name, targetState, liveState string) map[string]string {
+	return map[string]string{
+		"group":       group,
+		"kind":        kind,
+		"namespace":   namespace,
+		"name":        name,
+		"targetState": targetState,
+		"liveState":   liveState,
+	}
+}
+
+func managedResources(t *testing.T, resources ...map[string]string) string {
+	body, err := json.Marshal(map[string]interface{}{"items": resources})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestArgoAPICollectorGet(t *testing.T) {
+	ingress := `{"apiVersion":"extensions/v1beta1","kind":"Ingress","metadata":{"name":"web","namespace":"shop","labels":{"app":"shop"}}}`
+	clusterRole := `{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole","metadata":{"name":"shop-reader","labels":{"app":"shop"}}}`
+	psp := `{"apiVersion":"policy/v1beta1","kind":"PodSecurityPolicy","metadata":{"name":"shop","labels":{"app":"shop"}}}`
+	systemDeployment := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"dns","namespace":"kube-system","labels":{"app":"shop"}}}`
+	apiDeployment := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"api","namespace":"shop","labels":{"app":"api"}}}`
+
+	server := fakeArgoServer(t,
+		`{"items":[{"name":"prod","server":"https://prod.example.com"},{"name":"staging","server":"https://staging.example.com"}]}`,
+		`{"items":[
+			{"metadata":{"name":"web","namespace":"argocd"},"spec":{"destination":{"server":"https://prod.example.com/","namespace":"shop"}}},
+			{"metadata":{"name":"api","namespace":"team-a"},"spec":{"destination":{"name":"prod","namespace":"shop"}}},
+			{"metadata":{"name":"web-staging","namespace":"argocd"},"spec":{"destination":{"server":"https://staging.example.com","namespace":"shop"}}}
+		]}`,
+		map[string]string{
+			"argocd/web": managedResources(t,
+				managedResource("extensions", "Ingress", "shop", "web", ingress, ingress),
+				managedResource("apps", "Deployment", "kube-system", "dns", systemDeployment, systemDeployment),
+				managedResource("rbac.authorization.k8s.io", "ClusterRole", "", "shop-reader", clusterRole, "null"),
+				managedResource("policy", "PodSecurityPolicy", "", "shop", "null", psp),
+			),
+			"team-a/api": managedResources(t,
+				managedResource("apps", "Deployment", "shop", "api", apiDeployment, apiDeployment),
+			),
+		})
+	client, err := argoapi.NewClient(server.URL, fakeArgoToken, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := client.ListClusters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 2 || clusters[0].Name != "prod" {
+		t.Fatalf("unexpected clusters %+v", clusters)
+	}
+
+	ingresses := schema.GroupResource{Group: "extensions", Resource: "ingresses"}
+	psps := schema.GroupResource{Group: "policy", Resource: "podsecuritypolicies"}
+	collector, err := NewArgoAPICollector(client, &clusters[0], &ClusterOpts{
+		Namespaces:       []string{"shop"},
+		ClusterResources: true,
+		LabelSelector:    "app=shop",
+		RetainResources:  []schema.GroupResource{ingresses, psps},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := collector.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the target states in scope and matching the selector are judged
+	var kinds []string
+	for _, manifest := range manifests {
+		kinds = append(kinds, manifest["kind"].(string))
+	}
+	sort.Strings(kinds)
+	if len(kinds) != 2 || kinds[0] != "ClusterRole" || kinds[1] != "Ingress" {
+		t.Errorf("got the %v manifests, want the ClusterRole and the Ingress", kinds)
+	}
+	// the live states are retained, the null ones skipped
+	if objects := collector.Objects(ingresses); len(objects) != 1 || objects[0].GetName() != "web" {
+		t.Errorf("unexpected retained ingresses %+v", objects)
+	}
+	if objects := collector.Objects(psps); len(objects) != 1 || objects[0].GetName() != "shop" {
+		t.Errorf("unexpected retained podsecuritypolicies %+v", objects)
+	}
+}
+
+func TestArgoAPICollectorGetUnauthorized(t *testing.T) {
+	server := fakeArgoServer(t, `{"items":[]}`, `{"items":[]}`, nil)
+	client, err := argoapi.NewClient(server.URL, "wrong-token", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector, err := NewArgoAPICollector(client, &argoAppV1.Cluster{Name: "prod"}, &ClusterOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collector.Get(context.Background()); err == nil {
+		t.Error("got no error with a wrong token")
+	}
+}
+
+func TestNewArgoAPICollectorInvalidSelector(t *testing.T) {
+	if _, err := NewArgoAPICollector(nil, &argoAppV1.Cluster{Name: "prod"}, &ClusterOpts{LabelSelector: "app in (shop"}); err == nil {
+		t.Error("got no error with an invalid label selector")
+	}
+}
+
+func TestArgoAPICollectorDeploysTo(t *testing.T) {
+	collector := &ArgoAPICollector{cluster: argoAppV1.Cluster{Name: "prod", Server: "https://prod.example.com/"}}
+	tests := []struct {
+		destination argoAppV1.ApplicationDestination
+		want        bool
+	}{
+		{argoAppV1.ApplicationDestination{Name: "prod"}, true},
+		{argoAppV1.ApplicationDestination{Name: "staging", Server: "https://prod.example.com"}, false},
+		{argoAppV1.ApplicationDestination{Server: "https://prod.example.com"}, true},
+		{argoAppV1.ApplicationDestination{Server: "https://staging.example.com"}, false},
+	}
+	for _, test := range tests {
+		application := &argoAppV1.Application{Spec: argoAppV1.ApplicationSpec{Destination: test.destination}}
+		if got := collector.deploysTo(application); got != test.want {
+			t.Errorf("deploysTo(%+v) = %t, want %t", test.destination, got, test.want)
+		}
+	}
+}
+
+func TestArgoAPICollectorInScope(t *testing.T) {
+	tests := []struct {
+		namespaces       []string
+		clusterResources bool
+		namespace        string
+		want             bool
+	}{
+		{nil, false, "", true},
+		{nil, false, "shop", true},
+		{[]string{"shop"}, false, "shop", true},
+		{[]string{"shop"}, false, "kube-system", false},
+		{[]string{"shop"}, false, "", false},
+		{[]string{"shop"}, true, "", true},
+	}
+	for _, test := range tests {
+		collector := &ArgoAPICollector{namespaces: test.namespaces, clusterResources: test.clusterResources}
+		if got := collector.inScope(test.namespace); got != test.want {
+			t.Errorf("inScope(%q) of %v, cluster resources %t = %t, want %t",
+				test.namespace, test.namespaces, test.clusterResources, got, test.want)
+		}
+	}
+}
+
+func TestParseState(t *testing.T) {
+	for _, state := range []string{"", "null", "{not json", "[]"} {
+		if object := parseState(state); object != nil {
+			t.Errorf("parseState(%q) = %+v, want nil", state, object)
+		}
+	}
+	object := parseState(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"api"}}`)
+	if object == nil || object.GetKind() != "Deployment" || object.GetName() != "api" {
+		t.Errorf("unexpected object %+v", object)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gkarthiks/argo-apid-helper/config"
 	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/discovery"
 	memory "k8s.io/client-go/discovery/cached"
 	"k8s.io/client-go/dynamic"
@@ -21,11 +25,26 @@ type ClusterCollector struct {
 	*kubeCollector
 	clientSet           dynamic.Interface
 	additionalResources []schema.GroupVersionResource
+	mapper              meta.RESTMapper
+	namespaces          []string
+	clusterResources    bool
+	labelSelector       string
+	retainResources     sets.String
+	retained            map[string][]unstructured.Unstructured
 }
 
 type ClusterOpts struct {
 	ClientSet       dynamic.Interface
 	DiscoveryClient discovery.DiscoveryInterface
+	// Namespaces restricts the scan of namespaced resources to the given namespaces,
+	// mirroring the `namespaces` field of the argocd cluster secret
+	Namespaces []string
+	// ClusterResources allows listing cluster-scoped resources when Namespaces is set
+	ClusterResources bool
+	// LabelSelector is passed on to every list call
+	LabelSelector string
+	// RetainResources are the group-resources whose listed objects are kept for further analysis
+	RetainResources []schema.GroupResource
 }
 
 func NewClusterCollector(restConfig *rest.Config, opts *ClusterOpts, additionalKinds []string) (*ClusterCollector, error) {
@@ -35,8 +54,16 @@ func NewClusterCollector(restConfig *rest.Config, opts *ClusterOpts, additionalK
 	}
 
 	collector := &ClusterCollector{
-		kubeCollector:   kubeCollector,
-		commonCollector: newCommonCollector(config.ClusterCollectorName),
+		kubeCollector:    kubeCollector,
+		commonCollector:  newCommonCollector(config.ClusterCollectorName),
+		namespaces:       opts.Namespaces,
+		clusterResources: opts.ClusterResources,
+		labelSelector:    opts.LabelSelector,
+		retainResources:  sets.NewString(),
+		retained:         make(map[string][]unstructured.Unstructured),
+	}
+	for _, gr := range opts.RetainResources {
+		collector.retainResources.Insert(gr.String())
 	}
 
 	if opts.ClientSet == nil {
@@ -49,11 +76,11 @@ func NewClusterCollector(restConfig *rest.Config, opts *ClusterOpts, additionalK
 		collector.clientSet = opts.ClientSet
 	}
 
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(collector.discoveryClient))
+	collector.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(collector.discoveryClient))
 	for _, ar := range additionalKinds {
 		gvk, _ := schema.ParseKindArg(ar)
 
-		gvrMap, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		gvrMap, err := collector.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 		if err != nil {
 			log.Warn().Msgf("Failed to map %s Kind to resource: %s", gvk.Kind, err)
 			continue
@@ -65,7 +92,7 @@ func NewClusterCollector(restConfig *rest.Config, opts *ClusterOpts, additionalK
 	return collector, nil
 }
 
-func (c *ClusterCollector) Get() ([]map[string]interface{}, error) {
+func (c *ClusterCollector) Get(ctx context.Context) ([]map[string]interface{}, error) {
 	gvrs := []schema.GroupVersionResource{
 		{Group: "apps", Version: "v1", Resource: "daemonsets"},
 		{Group: "apps", Version: "v1", Resource: "deployments"},
@@ -99,35 +126,184 @@ func (c *ClusterCollector) Get() ([]map[string]interface{}, error) {
 		{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies"},
 		{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"},
 		{Group: "batch", Version: "v1", Resource: "cronjobs"},
+		{Group: "batch", Version: "v1", Resource: "jobs"},
+		{Group: "", Version: "v1", Resource: "services"},
+		{Group: "", Version: "v1", Resource: "persistentvolumeclaims"},
+		{Group: "", Version: "v1", Resource: "nodes"},
 	}
 	gvrs = append(gvrs, c.additionalResources...)
 
 	var results []map[string]interface{}
+	listed := make(map[schema.GroupVersionResource]bool)
+	c.retained = make(map[string][]unstructured.Unstructured)
 	for _, g := range gvrs {
-		ri := c.clientSet.Resource(g)
-		log.Debug().Msgf("Retrieving: %s.%s.%s", g.Resource, g.Version, g.Group)
-		rs, err := ri.List(context.Background(), metav1.ListOptions{})
-		if err != nil {
-			log.Debug().Msgf("Failed to retrieve: %s: %s", g, err)
-			if strings.Contains(err.Error(), "?timeout") {
-				return nil, errors.New("couldn't connect to the cluster; timeout error")
-			}
+		if listed[g] {
 			continue
 		}
+		listed[g] = true
 
-		for _, r := range rs.Items {
-			if jsonManifest, ok := r.GetAnnotations()["kubectl.kubernetes.io/last-applied-configuration"]; ok {
-				var manifest map[string]interface{}
+		namespaces, err := c.namespacesFor(g)
+		if err != nil {
+			log.Debug().Msgf("Skipping %s.%s.%s: %s", g.Resource, g.Version, g.Group, err)
+			continue
+		}
 
-				err := json.Unmarshal([]byte(jsonManifest), &manifest)
-				if err != nil {
-					log.Warn().Msgf("failed to parse 'last-applied-configuration' annotation of resource %s/%s: %v", r.GetNamespace(), r.GetName(), err)
-					continue
+		for _, ns := range namespaces {
+			ri := c.clientSet.Resource(g).Namespace(ns)
+			log.Debug().Msgf("Retrieving: %s.%s.%s in namespace '%s'", g.Resource, g.Version, g.Group, ns)
+			// the deprecated APIs the collector lists on its own warn even when there's nothing
+			// stored in them, their warnings only count along with objects
+			listCtx, warnings := withWarningBuffer(ctx)
+			rs, err := ri.List(listCtx, metav1.ListOptions{LabelSelector: c.labelSelector})
+			c.warnings.release(warnings, err == nil && len(rs.Items) > 0)
+			if err != nil {
+				// stop the scan right away when the caller has gone away
+				// or the server is shutting down
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
 				}
-				results = append(results, manifest)
+				log.Debug().Msgf("Failed to retrieve: %s: %s", g, err)
+				if strings.Contains(err.Error(), "?timeout") {
+					return nil, errors.New("couldn't connect to the cluster; timeout error")
+				}
+				continue
+			}
+			results = append(results, lastAppliedManifests(rs.Items)...)
+			if gr := g.GroupResource().String(); c.retainResources.Has(gr) {
+				c.retained[gr] = append(c.retained[gr], rs.Items...)
 			}
 		}
 	}
 
 	return results, nil
 }
+
+// Objects returns the objects of a retained group-resource listed by the last Get
+func (c *ClusterCollector) Objects(gr schema.GroupResource) []unstructured.Unstructured {
+	return c.retained[gr.String()]
+}
+
+// ListObjects lists the objects of the given resource within the scanned part of the cluster
+func (c *ClusterCollector) ListObjects(ctx context.Context, gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	namespaces, err := c.namespacesFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []unstructured.Unstructured
+	for _, ns := range namespaces {
+		rs, err := c.clientSet.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{LabelSelector: c.labelSelector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", gvr.GroupResource(), err)
+		}
+		objects = append(objects, rs.Items...)
+	}
+	return objects, nil
+}
+
+// ListNamespaces returns the namespaces of the scanned part of the cluster; the namespaces the
+// credentials are restricted to are read one by one, listing them needing cluster-wide access
+func (c *ClusterCollector) ListNamespaces(ctx context.Context) ([]unstructured.Unstructured, error) {
+	namespaceResource := schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	if len(c.namespaces) == 0 {
+		return c.ListObjects(ctx, namespaceResource)
+	}
+
+	var namespaces []unstructured.Unstructured
+	var errs []error
+	for _, ns := range c.namespaces {
+		namespace, err := c.clientSet.Resource(namespaceResource).Get(ctx, ns, metav1.GetOptions{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get the %s namespace: %w", ns, err))
+			continue
+		}
+		namespaces = append(namespaces, *namespace)
+	}
+	return namespaces, errors.Join(errs...)
+}
+
+// CountObjects counts the objects of the given resource within the scanned part of the cluster,
+// whatever the version they are stored in, without listing all of them, relying on the remaining
+// item count of a limited list
+func (c *ClusterCollector) CountObjects(ctx context.Context, gvr schema.GroupVersionResource, namespaced bool) (int64, error) {
+	namespaces := []string{metav1.NamespaceAll}
+	if namespaced && len(c.namespaces) > 0 {
+		namespaces = c.namespaces
+	}
+
+	var count int64
+	for _, ns := range namespaces {
+		rs, err := c.clientSet.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{Limit: 1})
+		if err != nil {
+			return 0, err
+		}
+		count += int64(len(rs.Items))
+		if remaining := rs.GetRemainingItemCount(); remaining != nil {
+			count += *remaining
+		}
+	}
+	return count, nil
+}
+
+// Scope reports which part of the cluster the collector scans
+func (c *ClusterCollector) Scope() config.ScanScope {
+	return config.ScanScope{
+		Namespaced:       len(c.namespaces) > 0,
+		Namespaces:       c.namespaces,
+		ClusterResources: len(c.namespaces) == 0 || c.clusterResources,
+		LabelSelector:    c.labelSelector,
+	}
+}
+
+// namespacesFor returns the namespaces to list the given resource in, an empty namespace
+// meaning all of them. The scope of the resource is looked up in the RESTMapper of the cluster
+// when the credentials are restricted to namespaces, failing for the cluster-scoped resources
+// without access to cluster resources and for the resources the cluster doesn't serve.
+func (c *ClusterCollector) namespacesFor(gvr schema.GroupVersionResource) ([]string, error) {
+	if len(c.namespaces) == 0 {
+		return []string{metav1.NamespaceAll}, nil
+	}
+	namespaced, err := c.namespaced(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the scope of %s: %w", gvr.GroupResource(), err)
+	}
+	if namespaced {
+		return c.namespaces, nil
+	}
+	if !c.clusterResources {
+		return nil, fmt.Errorf("cluster-scoped %s can't be listed with namespace restricted credentials", gvr.GroupResource())
+	}
+	return []string{metav1.NamespaceAll}, nil
+}
+
+// namespaced tells whether the cluster serves the resource as a namespaced one
+func (c *ClusterCollector) namespaced(gvr schema.GroupVersionResource) (bool, error) {
+	gvk, err := c.mapper.KindFor(gvr)
+	if err != nil {
+		return false, err
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// lastAppliedManifests extracts the manifests recorded in the
+// `last-applied-configuration` annotation of the given objects
+func lastAppliedManifests(items []unstructured.Unstructured) []map[string]interface{} {
+	var manifests []map[string]interface{}
+	for _, r := range items {
+		if jsonManifest, ok := r.GetAnnotations()["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+			var manifest map[string]interface{}
+
+			err := json.Unmarshal([]byte(jsonManifest), &manifest)
+			if err != nil {
+				log.Warn().Msgf("failed to parse 'last-applied-configuration' annotation of resource %s/%s: %v", r.GetNamespace(), r.GetName(), err)
+				continue
+			}
+			manifests = append(manifests, manifest)
+		}
+	}
+	return manifests
+}
@@ -1,18 +1,40 @@
 package collector
 
 import (
+	"context"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/argoapi"
+	"github.com/gkarthiks/argo-apid-helper/config"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 )
 
 type Collector interface {
-	Get() ([]map[string]interface{}, error)
+	Get(ctx context.Context) ([]map[string]interface{}, error)
 	Name() string
 }
 
 type VersionCollector interface {
-	GetServerVersion() (*judge.Version, error)
+	GetServerVersion(ctx context.Context) (*judge.Version, error)
+}
+
+// WarningCollector is implemented by collectors recording the warnings sent by the API server
+type WarningCollector interface {
+	Warnings() []config.ServerWarning
+}
+
+// ObjectCollector is implemented by collectors keeping the listed objects for further analysis
+type ObjectCollector interface {
+	Objects(gr schema.GroupResource) []unstructured.Unstructured
+	CountObjects(ctx context.Context, gvr schema.GroupVersionResource, namespaced bool) (int64, error)
+}
+
+// ScopedCollector is implemented by collectors that can be restricted to a part of the cluster
+type ScopedCollector interface {
+	Scope() config.ScanScope
 }
 
 type commonCollector struct {
@@ -32,12 +54,45 @@ func (c *commonCollector) Name() string {
 func InitCollectors(config *Config, restConfig *rest.Config) []Collector {
 	collectors := []Collector{}
 	if config.Cluster {
-		collector, err := NewClusterCollector(restConfig, &ClusterOpts{}, config.AdditionalKinds)
+		collector, err := NewClusterCollector(restConfig, &ClusterOpts{
+			Namespaces:       config.Namespaces,
+			ClusterResources: config.ClusterResources,
+			LabelSelector:    config.LabelSelector,
+			RetainResources:  config.RetainResources,
+		}, config.AdditionalKinds)
+		collectors = storeCollector(collector, err, collectors)
+	}
+	return collectors
+}
+
+// InitArgoAPICollectors initializes the collectors of a cluster known only to the ArgoCD API server
+func InitArgoAPICollectors(config *Config, client *argoapi.Client, cluster *argoAppV1.Cluster) []Collector {
+	collectors := []Collector{}
+	if config.Cluster {
+		collector, err := NewArgoAPICollector(client, cluster, &ClusterOpts{
+			Namespaces:       config.Namespaces,
+			ClusterResources: config.ClusterResources,
+			LabelSelector:    config.LabelSelector,
+			RetainResources:  config.RetainResources,
+		})
 		collectors = storeCollector(collector, err, collectors)
 	}
 	return collectors
 }
 
+// InitMetricsCollector initializes the collector of the requested deprecated APIs when enabled
+func InitMetricsCollector(config *Config, restConfig *rest.Config) *MetricsCollector {
+	if !config.Metrics {
+		return nil
+	}
+	collector, err := NewMetricsCollector(restConfig, &MetricsOpts{MetricsFile: config.MetricsFile})
+	if err != nil {
+		logrus.Errorf("Failed to initialize metrics collector: %v", err)
+		return nil
+	}
+	return collector
+}
+
 func storeCollector(collector Collector, err error, collectors []Collector) []Collector {
 	if err != nil {
 		logrus.Errorf("Failed to initialize collector: %v", collector)
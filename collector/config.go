@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/doitintl/kube-no-trouble/pkg/judge"
 	"github.com/doitintl/kube-no-trouble/pkg/printer"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"strings"
 	"unicode"
 )
@@ -14,6 +16,26 @@ type Config struct {
 	Cluster         bool
 	Output          string
 	TargetVersion   *judge.Version
+	// Namespaces and ClusterResources carry the scope of namespace restricted cluster credentials
+	Namespaces       []string
+	ClusterResources bool
+	// LabelSelector restricts the collected objects to the ones matching the selector
+	LabelSelector string
+	// RetainResources are the group-resources whose objects are kept for the analyses
+	RetainResources []schema.GroupResource
+	// Metrics enables the collection of the requested deprecated APIs from the API server metrics
+	Metrics     bool
+	MetricsFile string
+}
+
+// Scope returns the part of the cluster the collectors are configured to scan
+func (c *Config) Scope() *config.ScanScope {
+	return &config.ScanScope{
+		Namespaced:       len(c.Namespaces) > 0,
+		Namespaces:       c.Namespaces,
+		ClusterResources: len(c.Namespaces) == 0 || c.ClusterResources,
+		LabelSelector:    c.LabelSelector,
+	}
 }
 
 func NewCollectorConfig() (*Config, error) {
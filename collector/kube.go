@@ -1,24 +1,35 @@
 package collector
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
+	"net/http"
 )
 
 type kubeCollector struct {
 	discoveryClient discovery.DiscoveryInterface
 	restConfig      *rest.Config
+	warnings        *warningRecorder
 }
 
 func newKubeCollector(restConfig *rest.Config, discoveryClient discovery.DiscoveryInterface) (*kubeCollector, error) {
-	col := &kubeCollector{}
+	col := &kubeCollector{warnings: newWarningRecorder()}
 	if discoveryClient != nil {
 		col.discoveryClient = discoveryClient
 	} else {
 		var err error
-		col.restConfig = restConfig
+		// every client built from this config reports the API server warnings to the recorder
+		col.restConfig = rest.CopyConfig(restConfig)
+		col.restConfig.WarningHandler = col.warnings
+		col.restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &warningBufferTransport{next: rt}
+		})
 
 		if col.discoveryClient, err = discovery.NewDiscoveryClientForConfig(col.restConfig); err != nil {
 			return nil, fmt.Errorf("failed to create client: %w", err)
@@ -31,11 +42,36 @@ func (c *kubeCollector) GetRestConfig() *rest.Config {
 	return c.restConfig
 }
 
-func (c *kubeCollector) GetServerVersion() (*judge.Version, error) {
-	version, err := c.discoveryClient.ServerVersion()
+// Warnings returns the warnings sent by the API server so far
+func (c *kubeCollector) Warnings() []config.ServerWarning {
+	return c.warnings.Warnings()
+}
+
+func (c *kubeCollector) GetServerVersion(ctx context.Context) (*judge.Version, error) {
+	info, err := c.serverVersion(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get server version %w", err)
 	}
 
-	return judge.NewVersion(version.String())
+	return judge.NewVersion(info.String())
+}
+
+// serverVersion queries the /version endpoint with the given context so that the
+// call is abandoned along with the request; discovery clients without a rest client
+// (e.g. fakes) fall back to the context-less ServerVersion
+func (c *kubeCollector) serverVersion(ctx context.Context) (*version.Info, error) {
+	restClient := c.discoveryClient.RESTClient()
+	if restClient == nil {
+		return c.discoveryClient.ServerVersion()
+	}
+
+	body, err := restClient.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	var info version.Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse the server version: %w", err)
+	}
+	return &info, nil
 }
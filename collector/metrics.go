@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// deprecatedAPIsMetric is set by the API server for every deprecated API that has been requested
+// since its start, revealing the clients still calling them even when no stored object uses them
+const deprecatedAPIsMetric = "apiserver_requested_deprecated_apis"
+
+// MetricsCollector scrapes the API server's /metrics endpoint for the requested deprecated APIs
+type MetricsCollector struct {
+	*commonCollector
+	restClient  rest.Interface
+	metricsFile string
+}
+
+type MetricsOpts struct {
+	DiscoveryClient discovery.DiscoveryInterface
+	// MetricsFile parses the metrics from a local file in the prometheus text format
+	// instead of scraping the cluster, meant for testing
+	MetricsFile string
+}
+
+func NewMetricsCollector(restConfig *rest.Config, opts *MetricsOpts) (*MetricsCollector, error) {
+	collector := &MetricsCollector{
+		commonCollector: newCommonCollector(config.MetricsCollectorName),
+		metricsFile:     opts.MetricsFile,
+	}
+	if collector.metricsFile != "" {
+		return collector, nil
+	}
+
+	discoveryClient := opts.DiscoveryClient
+	if discoveryClient == nil {
+		var err error
+		if discoveryClient, err = discovery.NewDiscoveryClientForConfig(restConfig); err != nil {
+			return nil, fmt.Errorf("failed to create client: %w", err)
+		}
+	}
+	collector.restClient = discoveryClient.RESTClient()
+	if collector.restClient == nil {
+		return nil, fmt.Errorf("no rest client available to scrape the metrics")
+	}
+	return collector, nil
+}
+
+// GetRequestedDeprecatedAPIs returns the deprecated APIs the API server has served requests for
+func (c *MetricsCollector) GetRequestedDeprecatedAPIs(ctx context.Context) ([]config.RequestedDeprecatedAPI, error) {
+	var metrics []byte
+	var err error
+	if c.metricsFile != "" {
+		log.Debug().Msgf("Reading metrics from file %s", c.metricsFile)
+		metrics, err = os.ReadFile(c.metricsFile)
+	} else {
+		log.Debug().Msg("Retrieving metrics from the API server")
+		metrics, err = c.restClient.Get().AbsPath("/metrics").Do(ctx).Raw()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the metrics: %w", err)
+	}
+	return parseRequestedDeprecatedAPIs(metrics)
+}
+
+// parseRequestedDeprecatedAPIs extracts the apiserver_requested_deprecated_apis samples
+// from metrics in the prometheus text exposition format
+func parseRequestedDeprecatedAPIs(metrics []byte) ([]config.RequestedDeprecatedAPI, error) {
+	var requested []config.RequestedDeprecatedAPI
+	scanner := bufio.NewScanner(bytes.NewReader(metrics))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, deprecatedAPIsMetric+"{") {
+			continue
+		}
+
+		labels, value, err := parseSample(strings.TrimPrefix(line, deprecatedAPIsMetric))
+		if err != nil {
+			log.Warn().Msgf("failed to parse metric sample '%s': %v", line, err)
+			continue
+		}
+		// the gauge is 1 for the APIs requested since the start of the API server
+		if value != 1 {
+			continue
+		}
+		requested = append(requested, config.RequestedDeprecatedAPI{
+			Group:          labels["group"],
+			Version:        labels["version"],
+			Resource:       labels["resource"],
+			Subresource:    labels["subresource"],
+			RemovedRelease: labels["removed_release"],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the metrics: %w", err)
+	}
+	return requested, nil
+}
+
+// parseSample parses the `{label="value",...} sampleValue [timestamp]` part of a metric line
+func parseSample(sample string) (map[string]string, float64, error) {
+	labels := make(map[string]string)
+	i := 1 // skip the opening brace
+	for i < len(sample) && sample[i] != '}' {
+		eq := strings.IndexByte(sample[i:], '=')
+		if eq < 0 || i+eq+1 >= len(sample) || sample[i+eq+1] != '"' {
+			return nil, 0, fmt.Errorf("malformed label at offset %d", i)
+		}
+		name := strings.TrimSpace(sample[i : i+eq])
+		i += eq + 2
+
+		var value strings.Builder
+		for ; i < len(sample) && sample[i] != '"'; i++ {
+			if sample[i] == '\\' && i+1 < len(sample) {
+				i++
+				if sample[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(sample[i])
+		}
+		if i >= len(sample) {
+			return nil, 0, fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels[name] = value.String()
+		i++ // closing quote
+		if i < len(sample) && sample[i] == ',' {
+			i++
+		}
+	}
+	if i >= len(sample) {
+		return nil, 0, fmt.Errorf("unterminated label set")
+	}
+
+	fields := strings.Fields(sample[i+1:])
+	if len(fields) == 0 {
+		return nil, 0, fmt.Errorf("missing sample value")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid sample value: %w", err)
+	}
+	return labels, value, nil
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gkarthiks/argo-apid-helper/config"
+)
+
+func TestMetricsCollectorGetRequestedDeprecatedAPIs(t *testing.T) {
+	collector, err := NewMetricsCollector(nil, &MetricsOpts{MetricsFile: "testdata/metrics.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested, err := collector.GetRequestedDeprecatedAPIs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the samples of the APIs that aren't requested anymore and the malformed ones are skipped
+	want := []config.RequestedDeprecatedAPI{
+		{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies", RemovedRelease: "1.25"},
+		{Group: "autoscaling", Version: "v2beta2", Resource: "horizontalpodautoscalers", Subresource: "status", RemovedRelease: "1.26"},
+		{Group: "example.com", Version: "v1alpha1", Resource: "widgets"},
+	}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("got the requested apis %+v, want %+v", requested, want)
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		sample     string
+		wantLabels map[string]string
+		wantValue  float64
+		wantErr    bool
+	}{
+		{sample: `{group="apps",version="v1"} 1`, wantLabels: map[string]string{"group": "apps", "version": "v1"}, wantValue: 1},
+		{sample: `{group="",version="v1",} 0 1686825600000`, wantLabels: map[string]string{"group": "", "version": "v1"}, wantValue: 0},
+		{sample: `{message="a \"quoted\"\nline"} 2.5`, wantLabels: map[string]string{"message": "a \"quoted\"\nline"}, wantValue: 2.5},
+		{sample: `{} 1`, wantLabels: map[string]string{}, wantValue: 1},
+		{sample: `{group=apps} 1`, wantErr: true},
+		{sample: `{group="apps} 1`, wantErr: true},
+		{sample: `{group="apps"`, wantErr: true},
+		{sample: `{group="apps"}`, wantErr: true},
+		{sample: `{group="apps"} one`, wantErr: true},
+	}
+	for _, test := range tests {
+		labels, value, err := parseSample(test.sample)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseSample(%s) = %v, %v, want an error", test.sample, labels, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSample(%s): %v", test.sample, err)
+			continue
+		}
+		if !reflect.DeepEqual(labels, test.wantLabels) || value != test.wantValue {
+			t.Errorf("parseSample(%s) = %v, %v, want %v, %v", test.sample, labels, value, test.wantLabels, test.wantValue)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"context"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// deprecationWarningPattern matches the warnings sent by the API server for deprecated APIs, e.g.
+// `policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+, unavailable in v1.25+`
+var deprecationWarningPattern = regexp.MustCompile(`^(\S+) (\S+) is deprecated(?: in (v[0-9.]+)\+?)?(?:, unavailable in (v[0-9.]+)\+?)?`)
+
+// warningRecorder is a rest.WarningHandler remembering the warnings the API server sends
+// while collecting. This catches the deprecations of CRD versions and aggregated APIs
+// that none of the rego rules know about.
+type warningRecorder struct {
+	mu       sync.Mutex
+	warnings map[string]*config.ServerWarning
+	order    []string
+}
+
+func newWarningRecorder() *warningRecorder {
+	return &warningRecorder{
+		warnings: make(map[string]*config.ServerWarning),
+	}
+}
+
+// HandleWarningHeader records the `Warning: 299 - "<text>"` headers, counting the repetitions
+func (w *warningRecorder) HandleWarningHeader(code int, agent string, text string) {
+	text = strings.TrimSpace(text)
+	if code != 299 || len(text) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.record(text)
+}
+
+// release records the warnings of the buffer when keep is set and drops them otherwise, e.g.
+// the warnings of a deprecated API the collector listed itself without finding any object
+func (w *warningRecorder) release(buffer *warningBuffer, keep bool) {
+	if !keep {
+		return
+	}
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, text := range buffer.texts {
+		w.record(text)
+	}
+}
+
+func (w *warningRecorder) record(text string) {
+	if warning, found := w.warnings[text]; found {
+		warning.Count++
+		return
+	}
+
+	warning := &config.ServerWarning{
+		Message: text,
+		Count:   1,
+	}
+	if match := deprecationWarningPattern.FindStringSubmatch(text); match != nil {
+		warning.ApiVersion = match[1]
+		warning.Kind = match[2]
+		warning.DeprecatedIn = match[3]
+		warning.RemovedIn = match[4]
+	}
+	w.warnings[text] = warning
+	w.order = append(w.order, text)
+}
+
+// Warnings returns the recorded warnings in the order they were first seen
+func (w *warningRecorder) Warnings() []config.ServerWarning {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	warnings := make([]config.ServerWarning, 0, len(w.order))
+	for _, text := range w.order {
+		warnings = append(warnings, *w.warnings[text])
+	}
+	return warnings
+}
+
+type warningBufferKey struct{}
+
+// warningBuffer keeps the warnings of the requests made with its context aside until release
+// decides on them, every list of the collector having its own buffer whatever the other
+// requests sent to the cluster at the same time
+type warningBuffer struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+// withWarningBuffer returns a context whose requests keep their warnings in the returned buffer
+func withWarningBuffer(ctx context.Context) (context.Context, *warningBuffer) {
+	buffer := &warningBuffer{}
+	return context.WithValue(ctx, warningBufferKey{}, buffer), buffer
+}
+
+// warningBufferTransport moves the warnings of the responses to the buffer of the request
+// context, if any, before the warning handler of the client sees them
+type warningBufferTransport struct {
+	next http.RoundTripper
+}
+
+func (t *warningBufferTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	buffer, ok := req.Context().Value(warningBufferKey{}).(*warningBuffer)
+	if err != nil || !ok {
+		return resp, err
+	}
+
+	warnings, _ := utilnet.ParseWarningHeaders(resp.Header.Values("Warning"))
+	buffer.mu.Lock()
+	for _, warning := range warnings {
+		if text := strings.TrimSpace(warning.Text); warning.Code == 299 && len(text) > 0 {
+			buffer.texts = append(buffer.texts, text)
+		}
+	}
+	buffer.mu.Unlock()
+	resp.Header.Del("Warning")
+	return resp, nil
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// warningRoundTripper answers every request with the given warnings
+type warningRoundTripper []string
+
+func (w warningRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	for _, text := range w {
+		header.Add("Warning", `299 - "`+text+`"`)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Request: req}, nil
+}
+
+func TestWarningRecorderRelease(t *testing.T) {
+	recorder := newWarningRecorder()
+	pspWarning := "policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+, unavailable in v1.25+"
+	ingressWarning := "extensions/v1beta1 Ingress is deprecated in v1.14+, unavailable in v1.22+"
+	list := func(ctx context.Context, text string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://cluster.example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport := &warningBufferTransport{next: warningRoundTripper{text}}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the client hands over the warnings left in the response to the recorder
+		for _, warning := range resp.Header.Values("Warning") {
+			recorder.HandleWarningHeader(299, "", warning[len(`299 - "`):len(warning)-1])
+		}
+	}
+
+	// two overlapping lists, the empty one of a deprecated API dropping its warning
+	pspCtx, pspWarnings := withWarningBuffer(context.Background())
+	ingressCtx, ingressWarnings := withWarningBuffer(context.Background())
+	list(pspCtx, pspWarning)
+	list(ingressCtx, ingressWarning)
+	recorder.release(ingressWarnings, true)
+	recorder.release(pspWarnings, false)
+	// the requests without a buffer are recorded right away
+	list(context.Background(), ingressWarning)
+
+	warnings := recorder.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("got %d warnings, want 1: %+v", len(warnings), warnings)
+	}
+	warning := warnings[0]
+	if warning.ApiVersion != "extensions/v1beta1" || warning.Kind != "Ingress" || warning.Count != 2 ||
+		warning.DeprecatedIn != "v1.14" || warning.RemovedIn != "v1.22" {
+		t.Errorf("unexpected warning %+v", warning)
+	}
+}
@@ -1,11 +1,18 @@
 package config
 
 import (
+	"github.com/gkarthiks/argo-apid-helper/analysis"
+	"github.com/gkarthiks/argo-apid-helper/shard"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func InitializeEnvVar() {
+	var err error
 	appMode, avail := os.LookupEnv("APP_MODE")
 	if !avail {
 		logrus.Warn("defaulting app mode to production; results in Info log only")
@@ -33,8 +40,252 @@ func InitializeEnvVar() {
 	argocdNamespace, avail := os.LookupEnv("ARGOCD_NAMESPACE")
 	if !avail {
 		logrus.Warn("defaulting to `argocd` namespace")
-		ArgocdNamespace = DefaultArgoCDNamespace
+		ArgocdNamespaces = []string{DefaultArgoCDNamespace}
 	} else {
-		ArgocdNamespace = argocdNamespace
+		for _, ns := range strings.Split(argocdNamespace, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				ArgocdNamespaces = append(ArgocdNamespaces, ns)
+			}
+		}
 	}
+
+	namespaceSelector, avail := os.LookupEnv("ARGOCD_NAMESPACE_SELECTOR")
+	if avail {
+		if _, err = labels.Parse(namespaceSelector); err != nil {
+			logrus.Warnf("invalid ARGOCD_NAMESPACE_SELECTOR value '%s', ignoring it: %v", namespaceSelector, err)
+		} else {
+			ArgocdNamespaceSelector = namespaceSelector
+		}
+	}
+
+	if clusterSelector, avail := os.LookupEnv("CLUSTER_SELECTOR"); avail {
+		if ClusterSelector, err = labels.Parse(clusterSelector); err != nil {
+			logrus.Fatalf("invalid CLUSTER_SELECTOR value '%s': %v", clusterSelector, err)
+		}
+		// the local cluster and the clusters of the other sources than the cluster secrets have no labels
+		if !ClusterSelector.Empty() && !ClusterSelector.Matches(labels.Set{}) {
+			logrus.Infof("CLUSTER_SELECTOR '%s' leaves out the clusters without labels, like %s", ClusterSelector, LocalCluster.Name)
+		}
+	}
+
+	if argocdServer, avail := os.LookupEnv("ARGOCD_SERVER"); avail {
+		ArgocdServer = argocdServer
+		if ArgocdAuthToken, avail = os.LookupEnv("ARGOCD_AUTH_TOKEN"); !avail {
+			logrus.Warn("ARGOCD_AUTH_TOKEN is not provided, the argocd api server is called anonymously")
+		}
+	}
+
+	if argocdServerInsecure, avail := os.LookupEnv("ARGOCD_SERVER_INSECURE"); avail {
+		if ArgocdServerInsecure, err = strconv.ParseBool(argocdServerInsecure); err != nil {
+			logrus.Warnf("invalid ARGOCD_SERVER_INSECURE value '%s', defaulting to false", argocdServerInsecure)
+			ArgocdServerInsecure = false
+		}
+	}
+
+	ArgocdAPIPollInterval = DefaultArgoAPIPoll
+	if argoAPIPoll, avail := os.LookupEnv("ARGOCD_API_POLL_INTERVAL"); avail {
+		if ArgocdAPIPollInterval, err = time.ParseDuration(argoAPIPoll); err != nil || ArgocdAPIPollInterval <= 0 {
+			logrus.Warnf("invalid ARGOCD_API_POLL_INTERVAL value '%s', defaulting to %v", argoAPIPoll, DefaultArgoAPIPoll)
+			ArgocdAPIPollInterval = DefaultArgoAPIPoll
+		}
+	}
+
+	if shardReplicas, avail := os.LookupEnv("SHARD_REPLICAS"); avail {
+		if ShardReplicas, err = strconv.Atoi(shardReplicas); err != nil || ShardReplicas < 1 {
+			logrus.Warnf("invalid SHARD_REPLICAS value '%s', scanning every cluster", shardReplicas)
+			ShardReplicas = 1
+		}
+	}
+	if ShardReplicas > 1 {
+		initializeShard()
+	}
+
+	if scanInterval, avail := os.LookupEnv("SCAN_INTERVAL"); avail {
+		if ScanInterval, err = time.ParseDuration(scanInterval); err != nil || ScanInterval < 0 {
+			logrus.Warnf("invalid SCAN_INTERVAL value '%s', the scans are not scheduled", scanInterval)
+			ScanInterval = 0
+		}
+	}
+
+	if leaderElection, avail := os.LookupEnv("LEADER_ELECTION"); avail {
+		if LeaderElection, err = strconv.ParseBool(leaderElection); err != nil {
+			logrus.Warnf("invalid LEADER_ELECTION value '%s', defaulting to false", leaderElection)
+			LeaderElection = false
+		}
+	}
+	if LeaderElection {
+		initializeLeaderElection()
+	}
+
+	initializeResultStore()
+
+	if deprecationReports, avail := os.LookupEnv("DEPRECATION_REPORTS"); avail {
+		if DeprecationReports, err = strconv.ParseBool(deprecationReports); err != nil {
+			logrus.Warnf("invalid DEPRECATION_REPORTS value '%s', defaulting to false", deprecationReports)
+			DeprecationReports = false
+		}
+	}
+	DeprecationReportNamespace = DefaultArgoCDNamespace
+	if reportNamespace, avail := os.LookupEnv("DEPRECATION_REPORT_NAMESPACE"); avail && reportNamespace != "" {
+		DeprecationReportNamespace = reportNamespace
+	} else if len(ArgocdNamespaces) > 0 {
+		DeprecationReportNamespace = ArgocdNamespaces[0]
+	}
+	DeprecationReportInstance = DefaultReportInstance
+	if reportInstance, avail := os.LookupEnv("DEPRECATION_REPORT_INSTANCE"); avail && reportInstance != "" {
+		DeprecationReportInstance = reportInstance
+	}
+	if DeprecationReports && ScanInterval == 0 {
+		logrus.Warn("SCAN_INTERVAL is not provided, the deprecation reports are only written by the scans of the api")
+	}
+
+	deprecatedAPIMetrics, avail := os.LookupEnv("DEPRECATED_API_METRICS")
+	if !avail {
+		DeprecatedAPIMetrics = true
+	} else if DeprecatedAPIMetrics, err = strconv.ParseBool(deprecatedAPIMetrics); err != nil {
+		logrus.Warnf("invalid DEPRECATED_API_METRICS value '%s', defaulting to true", deprecatedAPIMetrics)
+		DeprecatedAPIMetrics = true
+	}
+
+	metricsFile, avail := os.LookupEnv("DEPRECATED_API_METRICS_FILE")
+	if avail {
+		logrus.Warnf("reading the deprecated api metrics from %s instead of the clusters", metricsFile)
+		DeprecatedAPIMetricsFile = metricsFile
+	}
+
+	auditLogDir, avail := os.LookupEnv("AUDIT_LOG_DIR")
+	if avail {
+		AuditLogDir = auditLogDir
+	}
+
+	if deprecatedRegistries, avail := os.LookupEnv("DEPRECATED_REGISTRIES"); avail {
+		registries, err := analysis.ParseDeprecatedRegistries(deprecatedRegistries, analysis.DefaultDeprecatedRegistries)
+		if err != nil {
+			logrus.Warnf("invalid DEPRECATED_REGISTRIES value '%s', defaulting to the retired kubernetes registries: %v", deprecatedRegistries, err)
+		} else {
+			DeprecatedRegistries = registries
+		}
+	}
+
+	AuditLogPollInterval = DefaultAuditLogPoll
+	if auditLogPoll, avail := os.LookupEnv("AUDIT_LOG_POLL_INTERVAL"); avail {
+		if AuditLogPollInterval, err = time.ParseDuration(auditLogPoll); err != nil || AuditLogPollInterval <= 0 {
+			logrus.Warnf("invalid AUDIT_LOG_POLL_INTERVAL value '%s', defaulting to %v", auditLogPoll, DefaultAuditLogPoll)
+			AuditLogPollInterval = DefaultAuditLogPoll
+		}
+	}
+
+	if kubeconfigSource, avail := os.LookupEnv("KUBECONFIG_SOURCE_PATH"); avail {
+		KubeconfigSourcePath = kubeconfigSource
+	}
+
+	KubeconfigSourcePollInterval = DefaultKubeconfigPoll
+	if kubeconfigPoll, avail := os.LookupEnv("KUBECONFIG_SOURCE_POLL_INTERVAL"); avail {
+		if KubeconfigSourcePollInterval, err = time.ParseDuration(kubeconfigPoll); err != nil || KubeconfigSourcePollInterval <= 0 {
+			logrus.Warnf("invalid KUBECONFIG_SOURCE_POLL_INTERVAL value '%s', defaulting to %v", kubeconfigPoll, DefaultKubeconfigPoll)
+			KubeconfigSourcePollInterval = DefaultKubeconfigPoll
+		}
+	}
+
+	if clusterAPISource, avail := os.LookupEnv("CLUSTER_API_SOURCE"); avail {
+		if ClusterAPISource, err = strconv.ParseBool(clusterAPISource); err != nil {
+			logrus.Warnf("invalid CLUSTER_API_SOURCE value '%s', defaulting to false", clusterAPISource)
+			ClusterAPISource = false
+		}
+	}
+
+	if clusterAPINamespace, avail := os.LookupEnv("CLUSTER_API_NAMESPACE"); avail {
+		ClusterAPINamespace = clusterAPINamespace
+	}
+}
+
+// initializeShard reads the shard of the replica, from SHARD or else the ordinal of the StatefulSet
+// pod, along with the URL template of the replicas and their shared secret
+func initializeShard() {
+	var err error
+	if shardNumber, avail := os.LookupEnv("SHARD"); avail {
+		if Shard, err = strconv.Atoi(shardNumber); err != nil {
+			logrus.Fatalf("invalid SHARD value '%s': %v", shardNumber, err)
+		}
+	} else {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logrus.Fatalf("unable to read the hostname for the shard of the replica: %v", err)
+		}
+		if Shard, err = shard.OrdinalOf(hostname); err != nil {
+			logrus.Fatalf("SHARD is not provided and the shard can't be derived from the hostname: %v", err)
+		}
+	}
+	if Shard < 0 || Shard >= ShardReplicas {
+		logrus.Fatalf("shard %d is out of the %d shards", Shard, ShardReplicas)
+	}
+
+	peerURL, avail := os.LookupEnv("SHARD_PEER_URL")
+	if !avail || !strings.Contains(peerURL, shard.Placeholder) {
+		logrus.Fatalf("SHARD_PEER_URL has to give the URL of the replicas with the %s placeholder, e.g. http://apid-helper-%s.apid-helper-headless", shard.Placeholder, shard.Placeholder)
+	}
+	ShardPeerURL = strings.TrimRight(peerURL, "/")
+	if ShardSecret = os.Getenv("SHARD_SECRET"); ShardSecret == "" {
+		logrus.Fatal("SHARD_SECRET has to give the secret shared by the replicas")
+	}
+	logrus.Infof("scanning the clusters of shard %d out of %d", Shard, ShardReplicas)
+}
+
+// initializeLeaderElection reads the Lease of the leader election, in the namespace of the pod
+// unless LEADER_ELECTION_NAMESPACE is given, and the identity of the replica
+func initializeLeaderElection() {
+	LeaderElectionNamespace = namespaceOrPod("LEADER_ELECTION_NAMESPACE")
+
+	LeaderElectionLease = DefaultLeaseName
+	if leaseName, avail := os.LookupEnv("LEADER_ELECTION_LEASE"); avail {
+		LeaderElectionLease = leaseName
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		logrus.Fatalf("unable to read the hostname for the leader election identity: %v", err)
+	}
+	LeaderElectionIdentity = hostname
+}
+
+// initializeResultStore reads the store keeping the scans along with the settings of its kind
+func initializeResultStore() {
+	ResultStore = ResultStoreMemory
+	if resultStore, avail := os.LookupEnv("RESULT_STORE"); avail {
+		ResultStore = strings.ToLower(resultStore)
+	}
+
+	switch ResultStore {
+	case ResultStoreMemory:
+	case ResultStoreFile:
+		resultStorePath, avail := os.LookupEnv("RESULT_STORE_PATH")
+		if !avail || resultStorePath == "" {
+			logrus.Fatal("RESULT_STORE_PATH has to give the directory of the scans with the file result store")
+		}
+		ResultStorePath = resultStorePath
+	case ResultStoreConfigMap:
+		ResultStoreNamespace = namespaceOrPod("RESULT_STORE_NAMESPACE")
+	case ResultStoreRedis:
+		redisURL, avail := os.LookupEnv("REDIS_URL")
+		if !avail || redisURL == "" {
+			logrus.Fatal("REDIS_URL has to give the redis server with the redis result store, e.g. redis://redis:6379/0")
+		}
+		RedisURL = redisURL
+	default:
+		logrus.Fatalf("unknown RESULT_STORE '%s', expected one of %s, %s, %s or %s", ResultStore,
+			ResultStoreMemory, ResultStoreFile, ResultStoreConfigMap, ResultStoreRedis)
+	}
+	logrus.Infof("keeping the scans in the %s result store", ResultStore)
+}
+
+// namespaceOrPod reads the namespace from the given variable, defaulting to the namespace of the pod
+func namespaceOrPod(variable string) string {
+	if namespace, avail := os.LookupEnv(variable); avail {
+		return namespace
+	}
+	namespace, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		logrus.Fatalf("%s is not provided and the namespace of the pod is unknown: %v", variable, err)
+	}
+	return strings.TrimSpace(string(namespace))
 }
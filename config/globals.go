@@ -1,41 +1,183 @@
 package config
 
 import (
+	"encoding/json"
 	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
 	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/analysis"
 	discovery "github.com/gkarthiks/k8s-discovery"
-	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/labels"
 	"sync"
+	"time"
 )
 
 var (
-	AppMode         string
-	ServerPort      string
-	AppVersion      string
-	ArgocdNamespace string
-	Router          *gin.Engine
-	KubeClient      *discovery.K8s
+	AppMode    string
+	ServerPort string
+	AppVersion string
+	// ArgocdNamespaces are the namespaces of the ArgoCD instances
+	ArgocdNamespaces []string
+	// ArgocdNamespaceSelector selects more namespaces of ArgoCD instances by label
+	ArgocdNamespaceSelector string
+	// ArgocdServer switches to the ArgoCD API server mode, reading the clusters and the resources
+	// through the API server authenticated with ArgocdAuthToken instead of the cluster secrets
+	ArgocdServer          string
+	ArgocdAuthToken       string
+	ArgocdServerInsecure  bool
+	ArgocdAPIPollInterval time.Duration
+	// ClusterSelector restricts the clusters to the ones whose cluster secret labels match
+	ClusterSelector = labels.Everything()
+	// ShardReplicas splits the clusters between the replicas, Shard being the one of this replica,
+	// ShardPeerURL the URL template of the replicas, see shard.PeerURL, and ShardSecret the secret
+	// shared by the replicas to tell the requests they forward to each other
+	ShardReplicas int
+	Shard         int
+	ShardPeerURL  string
+	ShardSecret   string
+	// ScanInterval schedules full scans of the clusters in the background, disabled when zero
+	ScanInterval time.Duration
+	// LeaderElection runs the background work on the replica holding the Lease only
+	LeaderElection          bool
+	LeaderElectionNamespace string
+	LeaderElectionLease     string
+	LeaderElectionIdentity  string
+	// ResultStore is the kind of store keeping the last scan of every cluster, the stores other than
+	// memory sharing the scans between the replicas
+	ResultStore          string
+	ResultStorePath      string
+	ResultStoreNamespace string
+	RedisURL             string
+	// DeprecationReports writes a DeprecationReport of every scanned cluster in DeprecationReportNamespace
+	DeprecationReports         bool
+	DeprecationReportNamespace string
+	// DeprecationReportInstance labels the reports of this release, the ones pruned by it
+	DeprecationReportInstance string
+	// DeprecatedAPIMetrics enables scraping the apiserver_requested_deprecated_apis metric
+	DeprecatedAPIMetrics bool
+	// DeprecatedAPIMetricsFile reads the metrics from a local file instead of the clusters
+	DeprecatedAPIMetricsFile string
+	// AuditLogDir is watched for the audit logs of the clusters, laid out as <dir>/<clusterName>/*.log
+	AuditLogDir          string
+	AuditLogPollInterval time.Duration
+	// DeprecatedRegistries are the image registries flagged in the workloads
+	DeprecatedRegistries = analysis.DefaultDeprecatedRegistries
+	// KubeconfigSourcePath is a kubeconfig file or directory whose contexts are registered as clusters
+	KubeconfigSourcePath         string
+	KubeconfigSourcePollInterval time.Duration
+	// ClusterAPISource registers the clusters of the Cluster API kubeconfig secrets of the
+	// ClusterAPINamespace, or of every namespace when empty
+	ClusterAPISource    bool
+	ClusterAPINamespace string
+	Router              *gin.Engine
+	KubeClient          *discovery.K8s
 
 	LocalCluster = argoAppV1.Cluster{
 		Name:            "in-cluster",
 		Server:          argoAppV1.KubernetesInternalAPIServerAddr,
 		ConnectionState: argoAppV1.ConnectionState{Status: argoAppV1.ConnectionStatusSuccessful},
 	}
-	InitLocalCluster           sync.Once
-	ArgoManagedClusterSecrets  []v1.Secret
-	ArgoManagedClusterNames    = sets.NewString()
-	ArgoClusterNameToSecretMap = make(map[string]v1.Secret)
+	InitLocalCluster sync.Once
 )
 
 const (
 	AppModeProd            = "production"
 	DefaultArgoCDNamespace = "argocd"
 	DefaultServerPort      = "8080"
-	ClusterCollectorName   = "Cluster"
+	DefaultAuditLogPoll    = 30 * time.Second
+	DefaultKubeconfigPoll  = time.Minute
+	DefaultArgoAPIPoll     = time.Minute
+	DefaultLeaseName       = "apid-helper-leader"
+	DefaultReportInstance  = "apid-helper"
+	ResultStoreMemory      = "memory"
+	ResultStoreFile        = "file"
+	ResultStoreConfigMap   = "configmap"
+	ResultStoreRedis       = "redis"
+	// ResultStorePrefix names the ConfigMaps and the Redis key of the scans
+	ResultStorePrefix = "apid-helper-scan"
+	// serviceAccountNamespaceFile holds the namespace of the pod
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	ClusterCollectorName        = "Cluster"
+	MetricsCollectorName        = "Metrics"
+	ArgoAPICollectorName        = "ArgoAPI"
 )
 
 type DeprecationResults struct {
-	ClusterName string      `json:"clusterName"`
-	Result      interface{} `json:"result"`
+	ClusterName             string                         `json:"clusterName"`
+	Instance                string                         `json:"instance,omitempty"`
+	ClusterLabels           map[string]string              `json:"clusterLabels,omitempty"`
+	ServerVersion           string                         `json:"serverVersion,omitempty"`
+	Scope                   *ScanScope                     `json:"scope,omitempty"`
+	Result                  interface{}                    `json:"result"`
+	ServerWarnings          []ServerWarning                `json:"serverWarnings,omitempty"`
+	RequestedDeprecatedAPIs []RequestedDeprecatedAPI       `json:"requestedDeprecatedAPIs,omitempty"`
+	CRDFindings             []analysis.CRDFinding          `json:"crdFindings,omitempty"`
+	RegistrationFindings    []analysis.RegistrationFinding `json:"registrationFindings,omitempty"`
+	FieldFindings           []analysis.FieldFinding        `json:"fieldFindings,omitempty"`
+	ImageFindings           []analysis.ImageFinding        `json:"imageFindings,omitempty"`
+	NodeFindings            []analysis.NodeFinding         `json:"nodeFindings,omitempty"`
+	// Nodes keeps the versions of the nodes to check them against any target version
+	Nodes            []analysis.NodeInfo `json:"nodes,omitempty"`
+	CollectionErrors []string            `json:"collectionErrors,omitempty"`
+}
+
+// UnmarshalJSON reads back the judged results as []judge.Result, or the error of a failed scan as
+// a string, as the results are shared between the replicas
+func (r *DeprecationResults) UnmarshalJSON(data []byte) error {
+	type results DeprecationResults
+	aux := struct {
+		*results
+		Result json.RawMessage `json:"result"`
+	}{results: (*results)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	r.Result = nil
+	if len(aux.Result) == 0 || string(aux.Result) == "null" {
+		return nil
+	}
+	if aux.Result[0] == '"' {
+		var scanError string
+		if err := json.Unmarshal(aux.Result, &scanError); err != nil {
+			return err
+		}
+		r.Result = scanError
+		return nil
+	}
+	var judged []judge.Result
+	if err := json.Unmarshal(aux.Result, &judged); err != nil {
+		return err
+	}
+	r.Result = judged
+	return nil
+}
+
+// ScanScope describes the part of a cluster that was scanned
+type ScanScope struct {
+	Namespaced       bool     `json:"namespaced"`
+	Namespaces       []string `json:"namespaces,omitempty"`
+	ClusterResources bool     `json:"clusterResources"`
+	LabelSelector    string   `json:"labelSelector,omitempty"`
+}
+
+// ServerWarning is a warning sent by the Kubernetes API server while collecting; the deprecation
+// details are filled in when the warning follows the API server's deprecation message format
+type ServerWarning struct {
+	Message      string `json:"message"`
+	ApiVersion   string `json:"apiVersion,omitempty"`
+	Kind         string `json:"kind,omitempty"`
+	DeprecatedIn string `json:"deprecatedIn,omitempty"`
+	RemovedIn    string `json:"removedIn,omitempty"`
+	Count        int    `json:"count"`
+}
+
+// RequestedDeprecatedAPI is a deprecated API that clients have requested from the API server,
+// as reported by its apiserver_requested_deprecated_apis metric
+type RequestedDeprecatedAPI struct {
+	Group          string `json:"group"`
+	Version        string `json:"version"`
+	Resource       string `json:"resource"`
+	Subresource    string `json:"subresource,omitempty"`
+	RemovedRelease string `json:"removedRelease,omitempty"`
 }
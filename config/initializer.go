@@ -18,5 +18,5 @@ func InitializeKubeClient() {
 	logrus.Infoln("initializing the Kube client")
 	KubeClient, _ = discovery.NewK8s()
 	version, _ := KubeClient.GetVersion()
-	logrus.Infoln("running %v version in the target cluster", version)
+	logrus.Infof("running %v version in the target cluster", version)
 }
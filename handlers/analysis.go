@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/analysis"
+	"github.com/gkarthiks/argo-apid-helper/collector"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// analysisResources are the group-resources the collectors keep for the analyses
+var analysisResources = append([]schema.GroupResource{
+	analysis.CRDResource,
+	analysis.MutatingWebhookResource,
+	analysis.ValidatingWebhookResource,
+	analysis.APIServiceResource,
+	analysis.NodeResource,
+}, analysis.ImageResources...)
+
+// runAnalyses runs the analyses over the collected manifests and the objects kept by the collectors
+// and adds the findings to the deprecation results of the cluster
+func runAnalyses(ctx context.Context, collectors []collector.Collector, manifests []map[string]interface{}, serverVersion *judge.Version, filter *deprecationFilter, deprecationResults *config.DeprecationResults) {
+	var controlPlaneVersion, targetVersion string
+	if serverVersion != nil {
+		controlPlaneVersion = serverVersion.String()
+	}
+	if filter.targetVersion != nil {
+		targetVersion = filter.targetVersion.String()
+	}
+
+	deprecationResults.FieldFindings = filter.applyFieldFindings(analysis.AnalyzeFields(manifests, analysis.FieldRules))
+	for _, c := range collectors {
+		objectCol, ok := c.(collector.ObjectCollector)
+		if !ok {
+			continue
+		}
+		deprecationResults.CRDFindings = append(deprecationResults.CRDFindings, analysis.AnalyzeCRDs(ctx, objectCol.Objects(analysis.CRDResource), objectCol)...)
+		deprecationResults.RegistrationFindings = append(deprecationResults.RegistrationFindings,
+			analysis.AnalyzeWebhooks(objectCol.Objects(analysis.MutatingWebhookResource), objectCol.Objects(analysis.ValidatingWebhookResource), targetVersion)...)
+		deprecationResults.RegistrationFindings = append(deprecationResults.RegistrationFindings,
+			analysis.AnalyzeAPIServices(objectCol.Objects(analysis.APIServiceResource), targetVersion)...)
+
+		var workloads []unstructured.Unstructured
+		for _, gr := range analysis.ImageResources {
+			workloads = append(workloads, objectCol.Objects(gr)...)
+		}
+		deprecationResults.ImageFindings = append(deprecationResults.ImageFindings,
+			filter.applyImageFindings(analysis.AnalyzeImages(workloads, config.DeprecatedRegistries))...)
+		deprecationResults.NodeFindings = append(deprecationResults.NodeFindings,
+			filter.applyNodeFindings(analysis.AnalyzeNodes(objectCol.Objects(analysis.NodeResource), controlPlaneVersion, targetVersion))...)
+		if filter.matches("Node", "v1") {
+			deprecationResults.Nodes = append(deprecationResults.Nodes, analysis.NodeInfos(objectCol.Objects(analysis.NodeResource))...)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/audit"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/shard"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxAuditLogUpload is the size limit of the uploaded audit logs
+const maxAuditLogUpload = 256 << 20
+
+var (
+	auditAnalyzer     *audit.Analyzer
+	auditAnalyzerErr  error
+	initAuditAnalyzer sync.Once
+)
+
+// getAuditAnalyzer lazily loads the rule set for the audit log analysis
+func getAuditAnalyzer() (*audit.Analyzer, error) {
+	initAuditAnalyzer.Do(func() {
+		regoJudge, err := newRegoJudge(nil)
+		if err != nil {
+			auditAnalyzerErr = err
+			return
+		}
+		auditAnalyzer = audit.NewAnalyzer(regoJudge)
+	})
+	return auditAnalyzer, auditAnalyzerErr
+}
+
+// WatchAuditLogs ingests the audit logs written under the configured directory
+// until the context is cancelled
+func WatchAuditLogs(ctx context.Context) {
+	analyzer, err := getAuditAnalyzer()
+	if err != nil {
+		logrus.Errorf("unable to start the audit log watcher: %v", err)
+		return
+	}
+	audit.NewWatcher(config.AuditLogDir, config.AuditLogPollInterval, analyzer, func(dirName string) (string, error) {
+		// only the known clusters of the shard of this replica are kept track of
+		cluster, err := resolveTargetCluster(dirName)
+		if err != nil {
+			return "", err
+		}
+		if owner := shard.Of(cluster, config.ShardReplicas); sharded() && owner != config.Shard {
+			return "", fmt.Errorf("the %s cluster belongs to shard %d", cluster.Name, owner)
+		}
+		return cluster.Name, nil
+	}).Run(ctx)
+}
+
+// IngestAuditLog ingests the Kubernetes audit log of the given cluster, uploaded either
+// as the `file` field of a multipart form or as the raw request body in JSON lines form
+func IngestAuditLog(c *gin.Context) {
+	// only the known clusters are kept track of
+	cluster, err := resolveTargetCluster(c.Param("clusterName"))
+	if err != nil {
+		logrus.Errorln(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	clusterName := cluster.Name
+	analyzer, err := getAuditAnalyzer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAuditLogUpload)
+	var auditLog io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			if tooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error": fmt.Sprintf("the audit log exceeds the %d bytes limit", maxAuditLogUpload),
+				})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("audit log file not found in the form: %v", err),
+			})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("unable to open the uploaded audit log: %v", err),
+			})
+			return
+		}
+		defer file.Close()
+		auditLog = file
+	}
+
+	logrus.Infof("ingesting the audit log of the %s cluster", clusterName)
+	count, err := analyzer.Ingest(clusterName, auditLog)
+	if err != nil {
+		logrus.Errorf("error occured while ingesting the audit log of the %s cluster: %v", clusterName, err)
+		status := http.StatusBadRequest
+		if tooLarge(err) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{
+			"clusterName":    clusterName,
+			"ingestedEvents": count,
+			"error":          err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"clusterName":    clusterName,
+		"ingestedEvents": count,
+	})
+}
+
+// tooLarge tells whether the error comes from reading past the size limit of the request body
+func tooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// GetAuditLogDeprecations lists the deprecated APIs called in the given cluster along with
+// the users, user agents and verbs calling them
+func GetAuditLogDeprecations(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	analyzer, err := getAuditAnalyzer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"clusterName": clusterName,
+		"results":     analyzer.Report(clusterName),
+	})
+}
+
+// ListAuditLogDeprecations lists the deprecated API calls of all the clusters audit logs were
+// ingested for, gathering the ones ingested by the replicas of the other shards
+func ListAuditLogDeprecations(c *gin.Context) {
+	analyzer, err := getAuditAnalyzer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var shardResults []config.DeprecationResults
+	waitShards := gatherShards(c, c.Request.URL.RequestURI(), func(body []byte) error {
+		var response struct {
+			AuditResults []config.DeprecationResults `json:"auditResults"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return err
+		}
+		shardResults = append(shardResults, response.AuditResults...)
+		return nil
+	})
+
+	auditResults := []config.DeprecationResults{}
+	for _, clusterName := range analyzer.Clusters() {
+		auditResults = append(auditResults, config.DeprecationResults{
+			ClusterName: clusterName,
+			Result:      analyzer.Report(clusterName),
+		})
+	}
+
+	response := gin.H{}
+	if unreachableShards := waitShards(); sharded() && !forwarded(c) {
+		auditResults = append(auditResults, shardResults...)
+		sort.SliceStable(auditResults, func(i, j int) bool {
+			return auditResults[i].ClusterName < auditResults[j].ClusterName
+		})
+		if len(unreachableShards) > 0 {
+			response["unreachableShards"] = unreachableShards
+		}
+	}
+	response["auditResults"] = auditResults
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/readiness"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"time"
+)
+
+// clusterDetail describes a cluster along with the outcome of its last full scan
+type clusterDetail struct {
+	Name             string                    `json:"name"`
+	Instance         string                    `json:"instance,omitempty"`
+	Source           string                    `json:"source,omitempty"`
+	Server           string                    `json:"server"`
+	ServerVersion    string                    `json:"serverVersion,omitempty"`
+	ConnectionState  argoAppV1.ConnectionState `json:"connectionState"`
+	Shard            *int64                    `json:"shard,omitempty"`
+	Project          string                    `json:"project,omitempty"`
+	Namespaces       []string                  `json:"namespaces,omitempty"`
+	ClusterResources bool                      `json:"clusterResources"`
+	Labels           map[string]string         `json:"labels,omitempty"`
+	Annotations      map[string]string         `json:"annotations,omitempty"`
+	LastScannedAt    *time.Time                `json:"lastScannedAt,omitempty"`
+	// Findings counts the findings of the last full scan against the next minor version
+	Findings *readiness.Readiness `json:"findings,omitempty"`
+}
+
+// newClusterDetail describes the cluster; the server version and the connection state come from
+// the last full scan, if any, unless the cluster already knows them, as the local cluster does
+func newClusterDetail(cluster *argoAppV1.Cluster, record *store.Record) clusterDetail {
+	detail := clusterDetail{
+		Name:             cluster.Name,
+		Instance:         clusterRegistry.Instance(cluster),
+		Source:           clusterRegistry.Source(cluster),
+		Server:           cluster.Server,
+		ServerVersion:    cluster.ServerVersion,
+		ConnectionState:  cluster.ConnectionState,
+		Shard:            cluster.Shard,
+		Project:          cluster.Project,
+		Namespaces:       cluster.Namespaces,
+		ClusterResources: cluster.ClusterResources,
+		Labels:           cluster.Labels,
+		Annotations:      cluster.Annotations,
+	}
+
+	if record == nil {
+		if detail.ConnectionState.Status == "" {
+			detail.ConnectionState.Status = argoAppV1.ConnectionStatusUnknown
+		}
+		return detail
+	}
+	scannedAt := record.ScannedAt
+	detail.LastScannedAt = &scannedAt
+	findings := readiness.Evaluate(*record, "")
+	detail.Findings = &findings
+	if detail.ServerVersion == "" {
+		detail.ServerVersion = record.Results.ServerVersion
+	}
+	if detail.ConnectionState.Status == "" {
+		modifiedAt := metav1.NewTime(record.ScannedAt)
+		detail.ConnectionState = argoAppV1.ConnectionState{Status: argoAppV1.ConnectionStatusSuccessful, ModifiedAt: &modifiedAt}
+		switch result := record.Results.Result.(type) {
+		case string:
+			detail.ConnectionState.Status = argoAppV1.ConnectionStatusFailed
+			detail.ConnectionState.Message = result
+		case error:
+			detail.ConnectionState.Status = argoAppV1.ConnectionStatusFailed
+			detail.ConnectionState.Message = result.Error()
+		}
+	}
+	return detail
+}
+
+// GetArgoCluster returns the details of the cluster of the given name
+func GetArgoCluster(c *gin.Context) {
+	cluster, err := resolveTargetCluster(c.Param("name"))
+	if err != nil {
+		logrus.Errorf("%v", err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	var lastScan *store.Record
+	if record, scanned, err := scanResults.Get(c.Request.Context(), cluster.Name); err != nil {
+		logrus.Warnf("unable to read the last scan of %s: %v", cluster.Name, err)
+	} else if scanned {
+		lastScan = &record
+	}
+	c.JSON(http.StatusOK, newClusterDetail(cluster, lastScan))
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"fmt"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/analysis"
+	"github.com/gkarthiks/argo-apid-helper/collector"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/readiness"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"strings"
+)
+
+// deprecationFilter narrows down the deprecation queries. The namespaces and the label selector
+// are pushed down to the collectors, whereas kind, group and removedIn can only be applied on
+// the judged results since the deprecated apiVersion is known only after judging.
+type deprecationFilter struct {
+	namespaces    []string
+	labelSelector string
+	kinds         sets.String
+	groups        sets.String
+	removedIn     *judge.Version
+	// targetVersion is the version the cluster is to be upgraded to, checked by the node analysis
+	targetVersion *judge.Version
+}
+
+// parseDeprecationFilter reads the filter from the `namespace`, `labelSelector`, `kind`, `group`,
+// `removedIn` and `targetVersion` query parameters; the list valued parameters accept comma
+// separated values
+func parseDeprecationFilter(c *gin.Context) (*deprecationFilter, error) {
+	filter := newDeprecationFilter()
+	filter.namespaces = splitQueryValues(c.Query("namespace"))
+	filter.labelSelector = strings.TrimSpace(c.Query("labelSelector"))
+
+	if filter.labelSelector != "" {
+		if _, err := labels.Parse(filter.labelSelector); err != nil {
+			return nil, fmt.Errorf("invalid labelSelector '%s': %v", filter.labelSelector, err)
+		}
+	}
+	for _, kind := range splitQueryValues(c.Query("kind")) {
+		filter.kinds.Insert(strings.ToLower(kind))
+	}
+	for _, group := range splitQueryValues(c.Query("group")) {
+		// the core group has no name in an apiVersion
+		if group == "core" {
+			group = ""
+		}
+		filter.groups.Insert(group)
+	}
+	var err error
+	if filter.removedIn, err = parseVersionQuery(c, "removedIn"); err != nil {
+		return nil, err
+	}
+	if filter.targetVersion, err = parseVersionQuery(c, "targetVersion"); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseClusterSelector reads the label selector of the clusters to scan from the `clusterSelector`
+// query parameter, matched against the labels of the cluster secrets
+func parseClusterSelector(c *gin.Context) (labels.Selector, error) {
+	value := strings.TrimSpace(c.Query("clusterSelector"))
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clusterSelector '%s': %v", value, err)
+	}
+	return selector, nil
+}
+
+// selectClusters returns the clusters whose labels match the selector
+func selectClusters(clusters []argoAppV1.Cluster, selector labels.Selector) []argoAppV1.Cluster {
+	if selector.Empty() {
+		return clusters
+	}
+	selected := make([]argoAppV1.Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		if selector.Matches(labels.Set(cluster.Labels)) {
+			selected = append(selected, cluster)
+		}
+	}
+	return selected
+}
+
+// newDeprecationFilter returns a filter letting everything through
+func newDeprecationFilter() *deprecationFilter {
+	return &deprecationFilter{
+		kinds:  sets.NewString(),
+		groups: sets.NewString(),
+	}
+}
+
+// parseVersionQuery parses the version given in the query parameter, if any
+func parseVersionQuery(c *gin.Context, name string) (*judge.Version, error) {
+	value := strings.TrimSpace(c.Query(name))
+	if value == "" {
+		return nil, nil
+	}
+	version, err := judge.NewVersion(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s version '%s': %v", name, value, err)
+	}
+	return version, nil
+}
+
+// narrows tells whether the filter drops part of the results or, with a target version, checks
+// the nodes for another version than the one of the full scans
+func (f *deprecationFilter) narrows() bool {
+	return len(f.namespaces) > 0 || f.labelSelector != "" || f.kinds.Len() > 0 || f.groups.Len() > 0 || f.removedIn != nil ||
+		f.targetVersion != nil
+}
+
+// applyScope pushes the namespace and label filters down to the collector configuration.
+// Asked namespaces are intersected with the namespaces the cluster credentials are restricted
+// to, and false is returned when nothing is left to scan.
+func (f *deprecationFilter) applyScope(collectorConfig *collector.Config) bool {
+	collectorConfig.LabelSelector = f.labelSelector
+	if len(f.namespaces) == 0 {
+		return true
+	}
+
+	// only the asked namespaces are of interest, hence no cluster-scoped resources
+	collectorConfig.ClusterResources = false
+	if len(collectorConfig.Namespaces) == 0 {
+		collectorConfig.Namespaces = f.namespaces
+		return true
+	}
+	allowed := sets.NewString(collectorConfig.Namespaces...).Intersection(sets.NewString(f.namespaces...))
+	collectorConfig.Namespaces = allowed.List()
+	return allowed.Len() > 0
+}
+
+// apply drops the judged results that do not match the kind, group and removedIn filters
+func (f *deprecationFilter) apply(results []judge.Result) []judge.Result {
+	if f.kinds.Len() == 0 && f.groups.Len() == 0 && f.removedIn == nil {
+		return results
+	}
+
+	filtered := []judge.Result{}
+	for _, result := range results {
+		if !f.matches(result.Kind, result.ApiVersion) {
+			continue
+		}
+		if f.removedIn != nil && !f.removedBy(readiness.JudgedRemovalRelease(&result)) {
+			continue
+		}
+		filtered = append(filtered, result)
+	}
+	return filtered
+}
+
+// removedBy tells whether the removal release is reached by the removedIn filter
+func (f *deprecationFilter) removedBy(release string) bool {
+	if release == "" {
+		return false
+	}
+	removal, err := judge.NewVersion(release)
+	return err == nil && !removal.GreaterThan(f.removedIn.Version)
+}
+
+// applyWarnings drops the server warnings that do not match the kind and group filters; warnings
+// not following the deprecation message format are kept only when there are no such filters
+func (f *deprecationFilter) applyWarnings(warnings []config.ServerWarning) []config.ServerWarning {
+	if f.kinds.Len() == 0 && f.groups.Len() == 0 {
+		return warnings
+	}
+
+	var filtered []config.ServerWarning
+	for _, warning := range warnings {
+		if warning.ApiVersion != "" && f.matches(warning.Kind, warning.ApiVersion) {
+			filtered = append(filtered, warning)
+		}
+	}
+	return filtered
+}
+
+// applyFieldFindings drops the field findings that do not match the kind and group filters
+func (f *deprecationFilter) applyFieldFindings(findings []analysis.FieldFinding) []analysis.FieldFinding {
+	if f.kinds.Len() == 0 && f.groups.Len() == 0 {
+		return findings
+	}
+
+	var filtered []analysis.FieldFinding
+	for _, finding := range findings {
+		if f.matches(finding.Kind, finding.ApiVersion) {
+			filtered = append(filtered, finding)
+		}
+	}
+	return filtered
+}
+
+// applyImageFindings drops the image findings that do not match the kind and group filters
+func (f *deprecationFilter) applyImageFindings(findings []analysis.ImageFinding) []analysis.ImageFinding {
+	if f.kinds.Len() == 0 && f.groups.Len() == 0 {
+		return findings
+	}
+
+	var filtered []analysis.ImageFinding
+	for _, finding := range findings {
+		if f.matches(finding.Kind, finding.ApiVersion) {
+			filtered = append(filtered, finding)
+		}
+	}
+	return filtered
+}
+
+// applyNodeFindings drops the node findings unless the kind and group filters match the nodes
+func (f *deprecationFilter) applyNodeFindings(findings []analysis.NodeFinding) []analysis.NodeFinding {
+	if f.matches("Node", "v1") {
+		return findings
+	}
+	return nil
+}
+
+// matches tells whether the kind and the group of the apiVersion pass the kind and group filters
+func (f *deprecationFilter) matches(kind, apiVersion string) bool {
+	if f.kinds.Len() > 0 && !f.kinds.Has(strings.ToLower(kind)) {
+		return false
+	}
+	if f.groups.Len() > 0 {
+		gv, err := schema.ParseGroupVersion(apiVersion)
+		if err != nil || !f.groups.Has(gv.Group) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRequestedAPIs drops the requested deprecated APIs that do not match the group and removedIn
+// filters; the metric knows only the resource, hence the kind filter can't be applied
+func (f *deprecationFilter) applyRequestedAPIs(requestedAPIs []config.RequestedDeprecatedAPI) []config.RequestedDeprecatedAPI {
+	if f.groups.Len() == 0 && f.removedIn == nil {
+		return requestedAPIs
+	}
+
+	var filtered []config.RequestedDeprecatedAPI
+	for _, requestedAPI := range requestedAPIs {
+		if f.groups.Len() > 0 && !f.groups.Has(requestedAPI.Group) {
+			continue
+		}
+		if f.removedIn != nil && !f.removedBy(requestedAPI.RemovedRelease) {
+			continue
+		}
+		filtered = append(filtered, requestedAPI)
+	}
+	return filtered
+}
+
+func splitQueryValues(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	goversion "github.com/hashicorp/go-version"
+	"k8s.io/apimachinery/pkg/labels"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeprecationFilterRemovedIn(t *testing.T) {
+	results := []judge.Result{
+		{
+			Name:        "restricted",
+			Kind:        "PodSecurityPolicy",
+			ApiVersion:  "policy/v1beta1",
+			RuleSet:     "Deprecated APIs removed in 1.25",
+			ReplaceWith: "N/A",
+			Since:       goversion.Must(goversion.NewVersion("1.21.0")),
+		},
+		{
+			Name:        "web",
+			Kind:        "Ingress",
+			ApiVersion:  "extensions/v1beta1",
+			RuleSet:     "Deprecated APIs removed in 1.22",
+			ReplaceWith: "networking.k8s.io/v1",
+			Since:       goversion.Must(goversion.NewVersion("1.14.0")),
+		},
+		{
+			Name:        "scaler",
+			Kind:        "HorizontalPodAutoscaler",
+			ApiVersion:  "autoscaling/v2beta2",
+			RuleSet:     "Deprecated APIs removed in 1.26",
+			ReplaceWith: "autoscaling/v2",
+			Since:       goversion.Must(goversion.NewVersion("1.23.0")),
+		},
+	}
+
+	tests := []struct {
+		removedIn string
+		want      []string
+	}{
+		{removedIn: "1.21", want: nil},
+		{removedIn: "1.22", want: []string{"web"}},
+		{removedIn: "1.25", want: []string{"restricted", "web"}},
+		{removedIn: "1.25.3", want: []string{"restricted", "web"}},
+		{removedIn: "1.26", want: []string{"restricted", "web", "scaler"}},
+	}
+	for _, test := range tests {
+		filter := newDeprecationFilter()
+		removedIn, err := judge.NewVersion(test.removedIn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter.removedIn = removedIn
+
+		var got []string
+		for _, result := range filter.apply(results) {
+			got = append(got, result.Name)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("removedIn=%s: got %v, want %v", test.removedIn, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("removedIn=%s: got %v, want %v", test.removedIn, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDeprecationFilterRequestedAPIs(t *testing.T) {
+	requestedAPIs := []config.RequestedDeprecatedAPI{
+		{Group: "extensions", Version: "v1beta1", Resource: "ingresses", RemovedRelease: "1.22"},
+		{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies", RemovedRelease: "1.25"},
+		{Group: "autoscaling", Version: "v2beta2", Resource: "horizontalpodautoscalers", RemovedRelease: "1.26"},
+		{Group: "example.com", Version: "v1alpha1", Resource: "widgets"},
+	}
+
+	tests := []struct {
+		removedIn string
+		groups    []string
+		want      []string
+	}{
+		{want: []string{"ingresses", "podsecuritypolicies", "horizontalpodautoscalers", "widgets"}},
+		{groups: []string{"policy", "example.com"}, want: []string{"podsecuritypolicies", "widgets"}},
+		{removedIn: "1.25", want: []string{"ingresses", "podsecuritypolicies"}},
+		{removedIn: "1.26", groups: []string{"autoscaling", "example.com"}, want: []string{"horizontalpodautoscalers"}},
+	}
+	for _, test := range tests {
+		filter := newDeprecationFilter()
+		filter.groups.Insert(test.groups...)
+		if test.removedIn != "" {
+			removedIn, err := judge.NewVersion(test.removedIn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter.removedIn = removedIn
+		}
+
+		var got []string
+		for _, requestedAPI := range filter.applyRequestedAPIs(requestedAPIs) {
+			got = append(got, requestedAPI.Resource)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("removedIn=%s, groups=%v: got %v, want %v", test.removedIn, test.groups, got, test.want)
+		}
+	}
+}
+
+func TestParseClusterSelector(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantEmpty bool
+		wantErr   bool
+	}{
+		{query: "", wantEmpty: true},
+		{query: "clusterSelector=", wantEmpty: true},
+		{query: "clusterSelector=environment%3Dprod"},
+		{query: "clusterSelector=environment+in+(prod,staging)"},
+		{query: "clusterSelector=environment+in+(prod", wantErr: true},
+		{query: "clusterSelector=%3Dprod", wantErr: true},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1alpha/deprecations?"+test.query, nil)
+		selector, err := parseClusterSelector(c)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got the error %v, want an error %t", test.query, err, test.wantErr)
+			continue
+		}
+		if err == nil && selector.Empty() != test.wantEmpty {
+			t.Errorf("%s: got the selector '%s', want an empty one %t", test.query, selector, test.wantEmpty)
+		}
+	}
+}
+
+func TestSelectClusters(t *testing.T) {
+	clusters := []argoAppV1.Cluster{
+		{Name: "in-cluster"},
+		{Name: "prod", Labels: map[string]string{"environment": "prod", "region": "eu"}},
+		{Name: "staging", Labels: map[string]string{"environment": "staging", "region": "eu"}},
+		{Name: "dev", Labels: map[string]string{"environment": "dev"}},
+	}
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{selector: "", want: []string{"in-cluster", "prod", "staging", "dev"}},
+		{selector: "environment=prod", want: []string{"prod"}},
+		{selector: "environment in (prod,staging)", want: []string{"prod", "staging"}},
+		{selector: "region", want: []string{"prod", "staging"}},
+		// the clusters without labels are only kept by the selectors not requiring a label
+		{selector: "environment!=dev", want: []string{"in-cluster", "prod", "staging"}},
+		{selector: "!region", want: []string{"in-cluster", "dev"}},
+		{selector: "environment=qa", want: []string{}},
+	}
+	for _, test := range tests {
+		selector, err := labels.Parse(test.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, cluster := range selectClusters(clusters, selector) {
+			got = append(got, cluster.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("selectClusters(%s) = %v, want %v", test.selector, got, test.want)
+		}
+	}
+}
@@ -2,49 +2,108 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/argoproj/argo-cd/v2/common"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/gkarthiks/argo-apid-helper/argoapi"
 	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/registry"
 	"github.com/sirupsen/logrus"
-	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/sets"
-	"strings"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
 )
 
-// PopulateArgoClusters will populate cluster secrets that are maintained by ArgoCD
-func PopulateArgoClusters(ctx context.Context) ([]v1.Secret, error) {
-	logrus.Debugln("getting the argocd managed cluster list via its secrets")
-	clusterSecretsList, err := config.KubeClient.Clientset.CoreV1().Secrets(config.ArgocdNamespace).List(ctx, metav1.ListOptions{LabelSelector: common.LabelKeySecretType + "=" + common.LabelValueSecretTypeCluster})
-	if err != nil {
-		logrus.Errorf("error occured while listing the argocd secrets: %v", err)
-		return nil, fmt.Errorf("error occured while listing the argocd secrets: %v", err.Error())
-	}
-	if clusterSecretsList == nil {
-		logrus.Errorln("no cluster secrets found that are managed by ArgoCD")
-		return nil, fmt.Errorf("no secrets found under the %s namespace for ArgoCD Clusters", config.ArgocdNamespace)
-	}
-	logrus.Debugf("total cluster secrets found that are managed by argocd: %v", len(clusterSecretsList.Items))
+var applicationResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
 
-	// kind of refreshing the list of argocd cluster secrets everytime this function is called
-	// in a way renewing the cache in-directly to be up-to-date as much as possible
-	config.ArgoManagedClusterSecrets = clusterSecretsList.Items
+// clusterRegistry holds the clusters of the cluster sources and argoClusters is the source of the
+// argocd cluster secrets, unless argoAPI reaches the clusters through the argocd api server
+var (
+	clusterRegistry = registry.New()
+	argoClusters    *registry.ArgoCDSource
+	argoAPI         *argoapi.Client
+)
 
-	return clusterSecretsList.Items, nil
+// WatchClusters registers the local cluster and keeps the cluster registry in sync with the cluster
+// secrets maintained by ArgoCD, or the clusters of the argocd api server when configured, and the
+// configured additional sources, returning once the existing clusters of every source are registered.
+// The scans and the reports of the clusters leaving the registry are dropped.
+func WatchClusters(ctx context.Context) error {
+	clusterRegistry.OnDelete(func(clusterName string) {
+		forgetCluster(ctx, clusterName)
+	})
+	var sources []registry.Source
+	if config.ArgocdServer != "" {
+		logrus.Infof("watching the argocd managed clusters via the %s argocd api server", config.ArgocdServer)
+		var err error
+		if argoAPI, err = argoapi.NewClient(config.ArgocdServer, config.ArgocdAuthToken, config.ArgocdServerInsecure); err != nil {
+			return err
+		}
+		sources = append(sources, registry.NewArgoCDAPISource(argoAPI, config.ArgocdAPIPollInterval))
+	} else {
+		logrus.Info("watching the argocd managed clusters via their secrets")
+		clusterRegistry.SetLocal(getLocalCluster(config.KubeClient.Clientset))
+		argoClusters = registry.NewArgoCDSource(config.KubeClient.Clientset, registry.WatchOpts{
+			Namespaces:        config.ArgocdNamespaces,
+			NamespaceSelector: config.ArgocdNamespaceSelector,
+			SecretSelector:    common.LabelKeySecretType + "=" + common.LabelValueSecretTypeCluster,
+		})
+		sources = append(sources, argoClusters)
+	}
+	if config.KubeconfigSourcePath != "" {
+		sources = append(sources, &registry.KubeconfigSource{Path: config.KubeconfigSourcePath, PollInterval: config.KubeconfigSourcePollInterval})
+	}
+	if config.ClusterAPISource {
+		metadataClient, err := metadata.NewForConfig(config.KubeClient.RestConfig)
+		if err != nil {
+			return fmt.Errorf("error occured while creating the client for the cluster api clusters: %v", err)
+		}
+		sources = append(sources, registry.NewClusterAPISource(config.KubeClient.Clientset, metadataClient, config.ClusterAPINamespace))
+	}
+	for _, source := range sources {
+		if err := source.Start(ctx, clusterRegistry); err != nil {
+			return fmt.Errorf("unable to start the %s cluster source: %v", source.Name(), err)
+		}
+	}
+	if config.ScanInterval == 0 && !config.LeaderElection && !sharded() {
+		// a lone replica without the background work, which prunes the reports otherwise
+		pruneReports(ctx)
+	}
+	return nil
 }
 
-// PopulateArgoClusterNames will populate the names of the clusters that are maintained by ArgoCD
-func PopulateArgoClusterNames(ctx context.Context) (sets.String, error) {
-	logrus.Info("getting the argocd managed cluster names list via its secrets")
-	clusterSecretsList, err := PopulateArgoClusters(ctx)
-	logrus.Debug("extracting the cluster names from the secret")
-	for _, clusterSecret := range clusterSecretsList {
-		sanitizedClusterName := strings.TrimSpace(string(clusterSecret.Data["name"]))
-		config.ArgoManagedClusterNames.Insert(sanitizedClusterName)
-		config.ArgoClusterNameToSecretMap[sanitizedClusterName] = clusterSecret
+// PopulateArgoApplications lists the ArgoCD applications of every ArgoCD instance; the applications
+// of the instances that could be listed are returned along with the errors of the others
+func PopulateArgoApplications(ctx context.Context) ([]argoAppV1.Application, error) {
+	logrus.Debugln("getting the argocd applications")
+	if argoAPI != nil {
+		return argoAPI.ListApplications(ctx)
 	}
+	dynamicClient, err := dynamic.NewForConfig(config.KubeClient.RestConfig)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error occured while creating the client for the argocd applications: %v", err)
+	}
+
+	var applications []argoAppV1.Application
+	var errs []error
+	for _, instance := range argoClusters.Instances() {
+		applicationList, err := dynamicClient.Resource(applicationResource).Namespace(instance).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error occured while listing the argocd applications of the %s namespace: %v", instance, err))
+			continue
+		}
+		for _, item := range applicationList.Items {
+			var application argoAppV1.Application
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &application); err != nil {
+				logrus.Warnf("unable to parse the argocd application %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+				continue
+			}
+			applications = append(applications, application)
+		}
 	}
-	return config.ArgoManagedClusterNames, nil
+	logrus.Debugf("total argocd applications found: %d", len(applications))
+	return applications, errors.Join(errs...)
 }
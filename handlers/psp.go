@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/analysis"
+	"github.com/gkarthiks/argo-apid-helper/collector"
+	"github.com/gkarthiks/argo-apid-helper/registry"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net/http"
+)
+
+var (
+	pspResource = schema.GroupVersionResource{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies"}
+	podResource = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	// workloadResources are checked against the Pod Security Standards through their pod templates
+	workloadResources = []schema.GroupVersionResource{
+		{Group: "apps", Version: "v1", Resource: "deployments"},
+		{Group: "apps", Version: "v1", Resource: "statefulsets"},
+		{Group: "apps", Version: "v1", Resource: "daemonsets"},
+		{Group: "batch", Version: "v1", Resource: "cronjobs"},
+		{Group: "batch", Version: "v1", Resource: "jobs"},
+	}
+)
+
+// GetPSPMigration maps the PodSecurityPolicies of the targeted cluster to the closest Pod Security
+// Standard levels and suggests the Pod Security Admission labels of each namespace
+func GetPSPMigration(c *gin.Context) {
+	ctx := c.Request.Context()
+	targetCluster := c.Param("clusterName")
+	logrus.Infof("processing the psp migration for the %s cluster", targetCluster)
+	cluster, err := resolveTargetCluster(targetCluster)
+	if err != nil {
+		logrus.Errorln(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if clusterRegistry.Source(cluster) == registry.SourceArgoCDAPI {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("the psp migration of %s cluster needs to list its policies and pods, which the argocd api server doesn't expose", targetCluster),
+		})
+		return
+	}
+
+	clusterCollector, err := collector.NewClusterCollector(restConfigFor(cluster), &collector.ClusterOpts{
+		Namespaces:       cluster.Namespaces,
+		ClusterResources: cluster.ClusterResources,
+	}, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("unable to initialize the collector for %s cluster: %v", targetCluster, err),
+		})
+		return
+	}
+
+	var collectionErrors []string
+	listObjects := func(gvr schema.GroupVersionResource) []unstructured.Unstructured {
+		objects, err := clusterCollector.ListObjects(ctx, gvr)
+		if err != nil {
+			logrus.Warnf("unable to collect for the psp migration of %s cluster: %v", targetCluster, err)
+			collectionErrors = append(collectionErrors, err.Error())
+		}
+		return objects
+	}
+
+	policies := listObjects(pspResource)
+	namespaces, err := clusterCollector.ListNamespaces(ctx)
+	if err != nil {
+		logrus.Warnf("unable to collect for the psp migration of %s cluster: %v", targetCluster, err)
+		collectionErrors = append(collectionErrors, err.Error())
+	}
+	pods := listObjects(podResource)
+	var workloads []unstructured.Unstructured
+	for _, gvr := range workloadResources {
+		workloads = append(workloads, listObjects(gvr)...)
+	}
+	if ctx.Err() != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": fmt.Sprintf("psp migration of %s cluster was interrupted: %v", targetCluster, ctx.Err()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clusterName":      cluster.Name,
+		"results":          analysis.AnalyzePSPMigration(policies, namespaces, workloads, pods),
+		"collectionErrors": collectionErrors,
+	})
+}
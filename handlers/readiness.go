@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/readiness"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+)
+
+// scanResults keeps the last full scan of every cluster, see InitResultStore
+var scanResults store.Store = store.NewMemory()
+
+// InitResultStore sets up the configured store of the scans in place of the memory
+func InitResultStore(ctx context.Context) error {
+	var err error
+	switch config.ResultStore {
+	case config.ResultStoreFile:
+		scanResults, err = store.NewFile(config.ResultStorePath)
+	case config.ResultStoreConfigMap:
+		scanResults = store.NewConfigMap(config.KubeClient.Clientset, config.ResultStoreNamespace, config.ResultStorePrefix)
+	case config.ResultStoreRedis:
+		scanResults, err = store.NewRedis(ctx, config.RedisURL, config.ResultStorePrefix)
+	}
+	return err
+}
+
+// recordScan keeps the results of a full scan; filtered and interrupted scans only tell
+// part of the story and are not kept
+func recordScan(ctx context.Context, filter *deprecationFilter, results *config.DeprecationResults) {
+	if filter.narrows() || ctx.Err() != nil || results == nil {
+		return
+	}
+	if err := scanResults.Save(ctx, results); err != nil {
+		logrus.Errorf("unable to keep the scan of %s: %v", results.ClusterName, err)
+	}
+	writeReport(ctx, results)
+}
+
+// forgetCluster drops the last scan and the report of a cluster that left the registry
+func forgetCluster(ctx context.Context, clusterName string) {
+	if err := scanResults.Delete(ctx, clusterName); err != nil {
+		logrus.Errorf("unable to drop the scan of %s: %v", clusterName, err)
+	}
+	deleteReport(ctx, clusterName)
+}
+
+// GetClusterReadiness returns the upgrade readiness of the targeted cluster for the `targetVersion`,
+// computed from the last full scan of the cluster unless a scan is missing or `refresh` is set
+func GetClusterReadiness(c *gin.Context) {
+	targetVersion, err := parseVersionQuery(c, "targetVersion")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	targetCluster := c.Param("clusterName")
+	cluster, err := resolveTargetCluster(targetCluster)
+	if err != nil {
+		logrus.Errorln(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	filter := newDeprecationFilter()
+	record, err := lastScan(ctx, *cluster, filter, c.Query("refresh") == "true")
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, readiness.Evaluate(record, versionString(targetVersion)))
+}
+
+// GetFleetReadiness returns the upgrade readiness of all the clusters for the `targetVersion`,
+// the riskiest first; clusters without a full scan yet are scanned on the way
+func GetFleetReadiness(c *gin.Context) {
+	targetVersion, err := parseVersionQuery(c, "targetVersion")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	clusters := ownClusters(listArgoClusters())
+
+	var shardFleet []readiness.Readiness
+	waitShards := gatherShards(c, c.Request.URL.RequestURI(), func(body []byte) error {
+		var response struct {
+			Clusters []readiness.Readiness `json:"clusters"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return err
+		}
+		shardFleet = append(shardFleet, response.Clusters...)
+		return nil
+	})
+
+	filter := newDeprecationFilter()
+	refresh := c.Query("refresh") == "true"
+	fleet := make([]readiness.Readiness, 0, len(clusters))
+	for _, cluster := range clusters {
+		record, err := lastScan(ctx, cluster, filter, refresh)
+		if err != nil {
+			logrus.Warnf("stopping the fleet readiness after %d of %d clusters: %v", len(fleet), len(clusters), err)
+			break
+		}
+		fleet = append(fleet, readiness.Evaluate(record, versionString(targetVersion)))
+	}
+	unreachableShards := waitShards()
+	fleet = append(fleet, shardFleet...)
+	readiness.SortByRisk(fleet)
+
+	statuses := map[string]int{
+		readiness.StatusReady:    0,
+		readiness.StatusWarnings: 0,
+		readiness.StatusBlocked:  0,
+	}
+	for _, clusterReadiness := range fleet {
+		statuses[clusterReadiness.Status]++
+	}
+	response := gin.H{
+		"totalClusters": len(fleet),
+		"statuses":      statuses,
+		"clusters":      fleet,
+	}
+	if len(unreachableShards) > 0 {
+		response["unreachableShards"] = unreachableShards
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListScans returns the last full scan of every cluster, gathered from every shard
+func ListScans(c *gin.Context) {
+	records, unreachableShards, err := fleetRecords(c)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	response := gin.H{
+		"totalScans": len(records),
+		"scans":      records,
+	}
+	if len(unreachableShards) > 0 {
+		response["unreachableShards"] = unreachableShards
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// fleetRecords returns the last full scans kept by this replica along with the ones of the other
+// shards, ordered by the cluster name; the shards sharing the store return the same scans, only
+// the latest scan of a cluster is kept
+func fleetRecords(c *gin.Context) ([]store.Record, []string, error) {
+	var shardRecords []store.Record
+	unreachableShards := gatherShards(c, "/v1alpha/scans", func(body []byte) error {
+		var response struct {
+			Scans []store.Record `json:"scans"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return err
+		}
+		shardRecords = append(shardRecords, response.Scans...)
+		return nil
+	})()
+
+	records, err := scanResults.List(c.Request.Context())
+	if err != nil {
+		return nil, unreachableShards, err
+	}
+	return latestRecords(append(records, shardRecords...)), unreachableShards, nil
+}
+
+// latestRecords keeps the latest record of every cluster, ordered by the cluster name
+func latestRecords(records []store.Record) []store.Record {
+	latest := make(map[string]store.Record, len(records))
+	for _, record := range records {
+		if kept, found := latest[record.Results.ClusterName]; !found || record.ScannedAt.After(kept.ScannedAt) {
+			latest[record.Results.ClusterName] = record
+		}
+	}
+	records = make([]store.Record, 0, len(latest))
+	for _, record := range latest {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Results.ClusterName < records[j].Results.ClusterName
+	})
+	return records
+}
+
+// lastScan returns the last full scan of the cluster, scanning it when there's none yet or
+// a refresh is asked
+func lastScan(ctx context.Context, cluster argoAppV1.Cluster, filter *deprecationFilter, refresh bool) (store.Record, error) {
+	if !refresh {
+		record, found, err := scanResults.Get(ctx, cluster.Name)
+		if err != nil {
+			logrus.Warnf("scanning %s again: %v", cluster.Name, err)
+		} else if found {
+			return record, nil
+		}
+	}
+	results := getDeprecationForCluster(ctx, cluster, filter)
+	if ctx.Err() != nil {
+		return store.Record{}, fmt.Errorf("scan of the %s cluster was interrupted: %v", cluster.Name, ctx.Err())
+	}
+	recordScan(ctx, filter, results)
+	record, _, err := scanResults.Get(ctx, cluster.Name)
+	return record, err
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/report"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+	"time"
+)
+
+// reportWriter writes the DeprecationReports when they are enabled
+var reportWriter *report.Writer
+
+// InitReportWriter sets up the writer of the DeprecationReports of the scanned clusters
+func InitReportWriter() error {
+	if !config.DeprecationReports {
+		return nil
+	}
+	dynamicClient, err := dynamic.NewForConfig(config.KubeClient.RestConfig)
+	if err != nil {
+		return fmt.Errorf("error occured while creating the client for the deprecation reports: %v", err)
+	}
+	reportWriter = report.NewWriter(dynamicClient, config.DeprecationReportNamespace, config.DeprecationReportInstance)
+	logrus.Infof("writing the deprecation reports of the %s instance in the %s namespace", config.DeprecationReportInstance, config.DeprecationReportNamespace)
+	return nil
+}
+
+// writeReport writes the DeprecationReport of a full scan
+func writeReport(ctx context.Context, results *config.DeprecationResults) {
+	if reportWriter == nil {
+		return
+	}
+	if err := reportWriter.Write(ctx, store.Record{Results: results, ScannedAt: time.Now()}); err != nil {
+		logrus.Errorf("unable to write the deprecation report of %s: %v", results.ClusterName, err)
+	}
+}
+
+// deleteReport deletes the DeprecationReport of a cluster that left the registry
+func deleteReport(ctx context.Context, clusterName string) {
+	if reportWriter == nil {
+		return
+	}
+	if err := reportWriter.Delete(ctx, clusterName); err != nil {
+		logrus.Errorf("unable to delete the deprecation report of %s: %v", clusterName, err)
+	}
+}
+
+// pruneReports deletes the DeprecationReports of the clusters that left while the helper was down;
+// it is run by a single replica, the leader or the first shard, which knows of every cluster
+func pruneReports(ctx context.Context) {
+	if reportWriter == nil {
+		return
+	}
+	clusters := listArgoClusters()
+	clusterNames := make([]string, 0, len(clusters))
+	for i := range clusters {
+		clusterNames = append(clusterNames, clusters[i].Name)
+	}
+	if err := reportWriter.Prune(ctx, clusterNames); err != nil {
+		logrus.Errorf("unable to prune the deprecation reports: %v", err)
+	}
+}
@@ -6,21 +6,22 @@ import (
 	"fmt"
 	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/doitintl/kube-no-trouble/pkg/judge"
-	"github.com/doitintl/kube-no-trouble/pkg/printer"
 	"github.com/doitintl/kube-no-trouble/pkg/rules"
 	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/analysis"
 	"github.com/gkarthiks/argo-apid-helper/collector"
 	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/readiness"
+	"github.com/gkarthiks/argo-apid-helper/registry"
+	"github.com/gkarthiks/argo-apid-helper/store"
 	"github.com/sirupsen/logrus"
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/utils/pointer"
+	"k8s.io/client-go/rest"
 	"net/http"
-	"strconv"
-	"strings"
-	"time"
+	"sort"
 )
 
 // HealthZ handler will return http.Response with `200 OK` for
@@ -32,19 +33,37 @@ func HealthZ(c *gin.Context) {
 }
 
 // GetArgoClusters will list the name of all the Kubernetes Clusters
-// that are managed by ArgoCD GitOps engine
+// that are managed by ArgoCD GitOps engine along with their details
 func GetArgoClusters(c *gin.Context) {
 	logrus.Info("listing the clusters managed by ArgoCD")
-	clusterNamesList, err := PopulateArgoClusterNames(c)
+	clusters := listArgoClusters()
+	records, unreachableShards, err := fleetRecords(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": fmt.Sprintf("error occured while populating the list: %v", err.Error()),
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
 		})
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"totalClusters": clusterNamesList.Len(),
-		"clusters":      clusterNamesList.List(),
-	})
+	lastScans := make(map[string]*store.Record, len(records))
+	for i := range records {
+		lastScans[records[i].Results.ClusterName] = &records[i]
+	}
+
+	clusterNames := make([]string, 0, len(clusters))
+	items := make([]clusterDetail, 0, len(clusters))
+	for i := range clusters {
+		clusterNames = append(clusterNames, clusters[i].Name)
+		items = append(items, newClusterDetail(&clusters[i], lastScans[clusters[i].Name]))
+	}
+	response := gin.H{
+		"totalClusters": len(clusters),
+		"clusters":      clusterNames,
+		"items":         items,
+	}
+	if len(unreachableShards) > 0 {
+		response["unreachableShards"] = unreachableShards
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // ListAPIDeprecations lists the api deprecations for all the clusters that are managed
@@ -52,77 +71,118 @@ func GetArgoClusters(c *gin.Context) {
 func ListAPIDeprecations(c *gin.Context) {
 	logrus.Info("listing the clusters managed by ArgoCD")
 
-	clusterSecrets, err := PopulateArgoClusters(c)
+	filter, err := parseDeprecationFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": fmt.Sprintf("error occured while populating the list of argo clusters: %v", err.Error()),
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
+		return
 	}
 
-	logrus.Debugf("total number of clusters found that are managed by ArgoCD: %d", len(clusterSecrets))
-	if config.AppMode != config.AppModeProd {
-		logrus.Debugln("Listing the secrets that are found as cluster secrets")
-		for _, sec := range clusterSecrets {
-			logrus.Debugf("Secret Name: %v", sec.Name)
-		}
-	}
-	clusterList := argoAppV1.ClusterList{
-		Items: make([]argoAppV1.Cluster, len(clusterSecrets)),
+	clusterSelector, err := parseClusterSelector(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	hasInClusterCredentials := false
-	for i, clusterSecret := range clusterSecrets {
-		cluster, err := secretToCluster(&clusterSecret)
-		if err != nil || cluster == nil {
-			logrus.Errorf("unable to convert cluster secret to cluster object '%s': %v", clusterSecret.Name, err)
-		}
+	ctx := c.Request.Context()
+	clusters := ownClusters(selectClusters(listArgoClusters(), clusterSelector))
 
-		clusterList.Items[i] = *cluster
-		if cluster.Server == argoAppV1.KubernetesInternalAPIServerAddr {
-			hasInClusterCredentials = true
+	var deprecationResults []config.DeprecationResults
+	var shardResults []config.DeprecationResults
+	waitShards := gatherShards(c, c.Request.URL.RequestURI(), func(body []byte) error {
+		var response struct {
+			DeprecationResults []config.DeprecationResults `json:"deprecationResults"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return err
 		}
+		shardResults = append(shardResults, response.DeprecationResults...)
+		return nil
+	})
+	for i := 0; i < len(clusters); i++ {
+		if ctx.Err() != nil {
+			logrus.Warnf("stopping the fleet scan after %d of %d clusters: %v", i, len(clusters), ctx.Err())
+			break
+		}
+		deprecationResult := getDeprecationForCluster(ctx, clusters[i], filter)
+		recordScan(ctx, filter, deprecationResult)
+		deprecationResults = append(deprecationResults, *relevantResults(deprecationResult, filter))
 	}
-	if !hasInClusterCredentials {
-		localCluster := getLocalCluster(config.KubeClient.Clientset)
-		if localCluster != nil {
-			clusterList.Items = append(clusterList.Items, *localCluster)
+
+	response := gin.H{}
+	if unreachableShards := waitShards(); sharded() && !forwarded(c) {
+		deprecationResults = append(deprecationResults, shardResults...)
+		sort.SliceStable(deprecationResults, func(i, j int) bool {
+			return deprecationResults[i].ClusterName < deprecationResults[j].ClusterName
+		})
+		if len(unreachableShards) > 0 {
+			response["unreachableShards"] = unreachableShards
 		}
 	}
+	response["deprecationResults"] = deprecationResults
+	c.JSON(200, response)
+}
+
+// listArgoClusters returns the clusters managed by ArgoCD along with the local cluster, restricted to
+// the ones matching the configured cluster selector
+func listArgoClusters() []argoAppV1.Cluster {
+	clusters := selectClusters(clusterRegistry.Clusters(), config.ClusterSelector)
+	logrus.Debugf("total number of clusters found that are managed by ArgoCD: %d", len(clusters))
 
 	if config.AppMode != config.AppModeProd {
 		logrus.Debugln("listing all the cluster names")
-		for idx, clusterName := range clusterList.Items {
-			logrus.Debugf("%d ) \t %v", idx, clusterName.Name)
+		for idx, cluster := range clusters {
+			logrus.Debugf("%d ) \t %v", idx, cluster.Name)
 		}
 	}
-
-	var deprecationResults []config.DeprecationResults
-	for i := 0; i < len(clusterList.Items); i++ {
-		deprecationResult := getDeprecationForCluster(c, clusterList.Items[i])
-		deprecationResults = append(deprecationResults, *deprecationResult)
-	}
-	c.JSON(200, gin.H{
-		"deprecationResults": deprecationResults,
-	})
+	return clusters
 }
 
 // getDeprecationForCluster works on the given cluster and returns the list of
 // API deprectation and associated workloads deployed against it
-func getDeprecationForCluster(ctx context.Context, cluster argoAppV1.Cluster) *config.DeprecationResults {
+func getDeprecationForCluster(ctx context.Context, cluster argoAppV1.Cluster, filter *deprecationFilter) *config.DeprecationResults {
 	logrus.Infof("starting to work on the %s cluster", cluster.Name)
 	var err error
 	collectorConfig, _ := collector.NewCollectorConfig()
+	collectorConfig.Namespaces = cluster.Namespaces
+	collectorConfig.ClusterResources = cluster.ClusterResources
+	// the metrics of the clusters known only to the argocd api server are out of reach
+	viaArgoAPI := clusterRegistry.Source(&cluster) == registry.SourceArgoCDAPI
+	collectorConfig.Metrics = config.DeprecatedAPIMetrics && !viaArgoAPI
+	collectorConfig.MetricsFile = config.DeprecatedAPIMetricsFile
+	collectorConfig.RetainResources = analysisResources
+	if len(cluster.Namespaces) > 0 {
+		logrus.Infof("%s cluster credentials are restricted to the namespaces %v; cluster resources allowed: %t", cluster.Name, cluster.Namespaces, cluster.ClusterResources)
+	}
+	if !filter.applyScope(collectorConfig) {
+		logrus.Infof("none of the requested namespaces %v are accessible in the %s cluster", filter.namespaces, cluster.Name)
+		return &config.DeprecationResults{
+			ClusterName:   cluster.Name,
+			ClusterLabels: cluster.Labels,
+			Scope:         collectorConfig.Scope(),
+			Result:        []judge.Result{},
+		}
+	}
 	logrus.Infoln("Initializing collectors and retrieving data")
-	initCollectors := collector.InitCollectors(collectorConfig, cluster.RawRestConfig())
+	var initCollectors []collector.Collector
+	if viaArgoAPI {
+		initCollectors = collector.InitArgoAPICollectors(collectorConfig, argoAPI, &cluster)
+	} else {
+		initCollectors = collector.InitCollectors(collectorConfig, restConfigFor(&cluster))
+	}
 
-	collectorConfig.TargetVersion, err = getServerVersion(collectorConfig.TargetVersion, initCollectors)
+	collectorConfig.TargetVersion, err = getServerVersion(ctx, collectorConfig.TargetVersion, initCollectors)
 	// If there's an error in communication with the cluster, return error for results
 	// against the cluster name
 	if err != nil {
 		logrus.Errorf("error occured while getting the deprecation result for %s cluster: %v", cluster.Name, err.Error())
 		return &config.DeprecationResults{
-			ClusterName: cluster.Name,
-			Result:      err.Error(),
+			ClusterName:   cluster.Name,
+			ClusterLabels: cluster.Labels,
+			Result:        err.Error(),
 		}
 	}
 
@@ -130,124 +190,157 @@ func getDeprecationForCluster(ctx context.Context, cluster argoAppV1.Cluster) *c
 		logrus.Infof("Target K8s version is %s", collectorConfig.TargetVersion.String())
 	}
 
-	collectors := getCollectors(initCollectors)
-
-	var additionalKinds []schema.GroupVersionKind
-	for _, ar := range collectorConfig.AdditionalKinds {
-		gvr, _ := schema.ParseKindArg(ar)
-		additionalKinds = append(additionalKinds, *gvr)
-	}
-
-	loadedRules, err := rules.FetchRegoRules(additionalKinds)
+	collectors, err := getCollectors(ctx, initCollectors)
 	if err != nil {
-		logrus.Fatalln("name: Rules; Failed to load rules")
+		logrus.Errorf("scan of the %s cluster was interrupted: %v", cluster.Name, err.Error())
+		return &config.DeprecationResults{
+			ClusterName:   cluster.Name,
+			ClusterLabels: cluster.Labels,
+			Result:        err.Error(),
+		}
 	}
 
-	judge, err := judge.NewRegoJudge(&judge.RegoOpts{}, loadedRules)
+	regoJudge, err := newRegoJudge(collectorConfig.AdditionalKinds)
 	if err != nil {
-		logrus.Fatalf("name: Rego; Failed to initialize decision engine: %v", err)
+		logrus.Fatalln(err)
 	}
 
-	results, err := judge.Eval(collectors)
+	results, err := regoJudge.Eval(collectors)
 	if err != nil {
 		logrus.Fatalf("name: Rego; Failed to evaluate input: %v", err)
 	}
 
-	results, err = printer.FilterNonRelevantResults(results, collectorConfig.TargetVersion)
-	if err != nil {
-		logrus.Fatalf("name: Rego; Failed to filter results: %v", err)
+	// the APIs deprecated after the version of the cluster are kept for the later target versions,
+	// see relevantResults
+	results = filter.apply(results)
+
+	deprecationResults := &config.DeprecationResults{
+		ClusterName:    cluster.Name,
+		Instance:       clusterRegistry.Instance(&cluster),
+		ClusterLabels:  cluster.Labels,
+		ServerVersion:  versionString(collectorConfig.TargetVersion),
+		Scope:          getScope(initCollectors),
+		Result:         results,
+		ServerWarnings: filter.applyWarnings(getServerWarnings(initCollectors)),
 	}
+	runAnalyses(ctx, initCollectors, collectors, collectorConfig.TargetVersion, filter, deprecationResults)
 
-	return &config.DeprecationResults{
-		ClusterName: cluster.Name,
-		Result:      results,
+	if metricsCollector := collector.InitMetricsCollector(collectorConfig, restConfigFor(&cluster)); metricsCollector != nil {
+		requestedAPIs, err := metricsCollector.GetRequestedDeprecatedAPIs(ctx)
+		if err != nil {
+			logrus.Errorf("collector name: %v; Failed to retrieve data from collector: %v", metricsCollector.Name(), err)
+			deprecationResults.CollectionErrors = append(deprecationResults.CollectionErrors, fmt.Sprintf("%s: %v", metricsCollector.Name(), err))
+		} else {
+			deprecationResults.RequestedDeprecatedAPIs = filter.applyRequestedAPIs(requestedAPIs)
+			logrus.Infof("collector name: %v; Retrieved %d requested deprecated apis from collector", metricsCollector.Name(), len(requestedAPIs))
+		}
 	}
+	return deprecationResults
 }
 
 // GetTargetClusterDeprecations will get the list of deprecations and the workloads
 // against those deprecated workloads on a targeted cluster
 func GetTargetClusterDeprecations(c *gin.Context) {
 	logrus.Info("processing deprecations for the targeted cluster")
+	filter, err := parseDeprecationFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx := c.Request.Context()
 	targetCluster := c.Param("clusterName")
 	logrus.Debugf("targeting the cluster: %s and checking if its a cluster managed by argocd ", targetCluster)
-	var deprecationResult *config.DeprecationResults
-	if config.ArgoManagedClusterNames.Has(targetCluster) {
-		logrus.Debugf("%s is a valid argocd managed cluster and proceeding with the deprecation list processing", targetCluster)
-		deprecationResult = proccedWithDeprecation(c, targetCluster)
-	} else if PopulateArgoClusterNames(c); config.ArgoManagedClusterNames.Has(targetCluster) {
-		logrus.Debugf("%s was found after refreshing the list of ArgoCD pre-populated cluster names", targetCluster)
-		deprecationResult = proccedWithDeprecation(c, targetCluster)
-	} else {
-		logrus.Errorf("%s not found from the list cluster managed by ArgoCD; It's not a valid cluster managed by ArgoCD", targetCluster)
+	cluster, err := resolveTargetCluster(targetCluster)
+	if err != nil {
+		logrus.Errorln(err)
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("%s not found from the list cluster managed by ArgoCD; It's not a valid cluster managed by ArgoCD", targetCluster),
+			"error": err.Error(),
 		})
+		return
 	}
+	logrus.Debugf("%s is a valid argocd managed cluster and proceeding with the deprecation list processing", targetCluster)
+	deprecationResult := getDeprecationForCluster(ctx, *cluster, filter)
+	recordScan(ctx, filter, deprecationResult)
 	logrus.Debugf("returning the resultant data for %s cluster", targetCluster)
-	c.JSON(http.StatusOK, gin.H{
-		"clusterName": deprecationResult.ClusterName,
-		"results":     deprecationResult.Result,
-	})
+	c.JSON(http.StatusOK, newClusterDeprecationsResponse(relevantResults(deprecationResult, filter)))
 
 }
 
-func proccedWithDeprecation(ctx context.Context, clusterName string) *config.DeprecationResults {
-	logrus.Debugf("proceeding with the deprecation analysis for the target cluster: %s", clusterName)
-	targetClusterSecret := config.ArgoClusterNameToSecretMap[clusterName]
-	cluster, err := secretToCluster(&targetClusterSecret)
-	if err != nil || cluster == nil {
-		logrus.Errorf("unable to convert cluster secret to cluster object '%s': %v", targetClusterSecret.Name, err)
-		return &config.DeprecationResults{
-			ClusterName: clusterName,
-			Result:      fmt.Errorf("unable to convert cluster secret to cluster object '%s': %v", targetClusterSecret.Name, err),
-		}
+// relevantResults returns the results with the judged APIs deprecated in the requested target
+// version, or else in the version of the cluster, the scans keeping every judged API
+func relevantResults(results *config.DeprecationResults, filter *deprecationFilter) *config.DeprecationResults {
+	judged, ok := results.Result.([]judge.Result)
+	if !ok {
+		return results
+	}
+	version := results.ServerVersion
+	if filter.targetVersion != nil {
+		version = filter.targetVersion.String()
 	}
-	return getDeprecationForCluster(ctx, *cluster)
+	relevant := *results
+	relevant.Result = readiness.DeprecatedBy(judged, version)
+	return &relevant
 }
 
-// secretToCluster converts a secret into a Cluster object
-func secretToCluster(s *corev1.Secret) (*argoAppV1.Cluster, error) {
-	var clusterConfig argoAppV1.ClusterConfig
-	if len(s.Data["config"]) > 0 {
-		if err := json.Unmarshal(s.Data["config"], &clusterConfig); err != nil {
-			// This line has changed from the original Argo CD: now returns an error rather than panicing.
-			return nil, err
-		}
-	}
+// clusterDeprecationsResponse is the response of the per-cluster endpoint, with the judged results
+// under `results` as the endpoint always did and the error of a failed scan under `error`
+type clusterDeprecationsResponse struct {
+	ClusterName             string                          `json:"clusterName"`
+	Instance                string                          `json:"instance,omitempty"`
+	ClusterLabels           map[string]string               `json:"clusterLabels,omitempty"`
+	ServerVersion           string                          `json:"serverVersion,omitempty"`
+	Scope                   *config.ScanScope               `json:"scope,omitempty"`
+	Results                 []judge.Result                  `json:"results"`
+	Error                   string                          `json:"error,omitempty"`
+	ServerWarnings          []config.ServerWarning          `json:"serverWarnings,omitempty"`
+	RequestedDeprecatedAPIs []config.RequestedDeprecatedAPI `json:"requestedDeprecatedAPIs,omitempty"`
+	CRDFindings             []analysis.CRDFinding           `json:"crdFindings,omitempty"`
+	RegistrationFindings    []analysis.RegistrationFinding  `json:"registrationFindings,omitempty"`
+	FieldFindings           []analysis.FieldFinding         `json:"fieldFindings,omitempty"`
+	ImageFindings           []analysis.ImageFinding         `json:"imageFindings,omitempty"`
+	NodeFindings            []analysis.NodeFinding          `json:"nodeFindings,omitempty"`
+	CollectionErrors        []string                        `json:"collectionErrors,omitempty"`
+}
 
-	var namespaces []string
-	for _, ns := range strings.Split(string(s.Data["namespaces"]), ",") {
-		if ns = strings.TrimSpace(ns); ns != "" {
-			namespaces = append(namespaces, ns)
-		}
+func newClusterDeprecationsResponse(results *config.DeprecationResults) clusterDeprecationsResponse {
+	response := clusterDeprecationsResponse{
+		ClusterName:             results.ClusterName,
+		Instance:                results.Instance,
+		ClusterLabels:           results.ClusterLabels,
+		ServerVersion:           results.ServerVersion,
+		Scope:                   results.Scope,
+		ServerWarnings:          results.ServerWarnings,
+		RequestedDeprecatedAPIs: results.RequestedDeprecatedAPIs,
+		CRDFindings:             results.CRDFindings,
+		RegistrationFindings:    results.RegistrationFindings,
+		FieldFindings:           results.FieldFindings,
+		ImageFindings:           results.ImageFindings,
+		NodeFindings:            results.NodeFindings,
+		CollectionErrors:        results.CollectionErrors,
 	}
-	var refreshRequestedAt *metav1.Time
-	if v, found := s.Annotations[argoAppV1.AnnotationKeyRefresh]; found {
-		requestedAt, err := time.Parse(time.RFC3339, v)
-		if err != nil {
-			logrus.Warnf("Error while parsing date in cluster secret '%s': %v", s.Name, err)
-		} else {
-			refreshRequestedAt = &metav1.Time{Time: requestedAt}
-		}
+	switch result := results.Result.(type) {
+	case []judge.Result:
+		response.Results = result
+	case string:
+		response.Error = result
+	case error:
+		response.Error = result.Error()
 	}
-	var shard *int64
-	if shardStr := s.Data["shard"]; shardStr != nil {
-		if val, err := strconv.Atoi(string(shardStr)); err != nil {
-			logrus.Warnf("Error while parsing shard in cluster secret '%s': %v", s.Name, err)
-		} else {
-			shard = pointer.Int64Ptr(int64(val))
-		}
+	return response
+}
+
+// resolveTargetCluster returns the argocd managed cluster of the given name
+func resolveTargetCluster(clusterName string) (*argoAppV1.Cluster, error) {
+	cluster, found := clusterRegistry.Get(clusterName)
+	if !found {
+		return nil, fmt.Errorf("%s not found from the list cluster managed by ArgoCD; It's not a valid cluster managed by ArgoCD", clusterName)
 	}
-	cluster := argoAppV1.Cluster{
-		ID:                 string(s.UID),
-		Server:             strings.TrimRight(string(s.Data["server"]), "/"),
-		Name:               string(s.Data["name"]),
-		Namespaces:         namespaces,
-		Config:             clusterConfig,
-		RefreshRequestedAt: refreshRequestedAt,
-		Shard:              shard,
+	if !config.ClusterSelector.Matches(labels.Set(cluster.Labels)) {
+		return nil, fmt.Errorf("%s cluster is not selected by the configured cluster selector '%s'", clusterName, config.ClusterSelector)
 	}
-	return &cluster, nil
+	return cluster, nil
 }
 
 func getLocalCluster(clientset kubernetes.Interface) *argoAppV1.Cluster {
@@ -269,11 +362,24 @@ func getLocalCluster(clientset kubernetes.Interface) *argoAppV1.Cluster {
 	return cluster
 }
 
-func getServerVersion(cv *judge.Version, collectors []collector.Collector) (*judge.Version, error) {
+// restConfigFor returns the rest config to reach the cluster; the local cluster is reached
+// with the service account of the helper and the clusters of the kubeconfig sources with the
+// credentials of their kubeconfig
+func restConfigFor(cluster *argoAppV1.Cluster) *rest.Config {
+	if registry.IsLocal(cluster) {
+		return rest.CopyConfig(config.KubeClient.RestConfig)
+	}
+	if restConfig, found := clusterRegistry.RestConfig(cluster); found {
+		return restConfig
+	}
+	return cluster.RawRestConfig()
+}
+
+func getServerVersion(ctx context.Context, cv *judge.Version, collectors []collector.Collector) (*judge.Version, error) {
 	if cv == nil {
 		for _, c := range collectors {
 			if versionCol, ok := c.(collector.VersionCollector); ok {
-				version, err := versionCol.GetServerVersion()
+				version, err := versionCol.GetServerVersion(ctx)
 				if err != nil {
 					return nil, fmt.Errorf("failed to detect k8s version: %w", err)
 				}
@@ -284,10 +390,63 @@ func getServerVersion(cv *judge.Version, collectors []collector.Collector) (*jud
 	return cv, nil
 }
 
-func getCollectors(collectors []collector.Collector) []map[string]interface{} {
+func versionString(version *judge.Version) string {
+	if version == nil || version.Version == nil {
+		return ""
+	}
+	return version.String()
+}
+
+// newRegoJudge loads the deprecation rules, along with the rules for the additional kinds,
+// into the rego decision engine
+func newRegoJudge(kinds []string) (judge.Judge, error) {
+	var additionalKinds []schema.GroupVersionKind
+	for _, ar := range kinds {
+		gvr, _ := schema.ParseKindArg(ar)
+		additionalKinds = append(additionalKinds, *gvr)
+	}
+
+	loadedRules, err := rules.FetchRegoRules(additionalKinds)
+	if err != nil {
+		return nil, fmt.Errorf("name: Rules; Failed to load rules: %w", err)
+	}
+
+	regoJudge, err := judge.NewRegoJudge(&judge.RegoOpts{}, loadedRules)
+	if err != nil {
+		return nil, fmt.Errorf("name: Rego; Failed to initialize decision engine: %w", err)
+	}
+	return regoJudge, nil
+}
+
+// getScope returns the scan scope reported by the first collector that can be restricted
+func getScope(collectors []collector.Collector) *config.ScanScope {
+	for _, c := range collectors {
+		if scopedCol, ok := c.(collector.ScopedCollector); ok {
+			scope := scopedCol.Scope()
+			return &scope
+		}
+	}
+	return nil
+}
+
+// getServerWarnings gathers the warnings the API server sent to the collectors
+func getServerWarnings(collectors []collector.Collector) []config.ServerWarning {
+	var warnings []config.ServerWarning
+	for _, c := range collectors {
+		if warningCol, ok := c.(collector.WarningCollector); ok {
+			warnings = append(warnings, warningCol.Warnings()...)
+		}
+	}
+	return warnings
+}
+
+func getCollectors(ctx context.Context, collectors []collector.Collector) ([]map[string]interface{}, error) {
 	var inputs []map[string]interface{}
 	for _, c := range collectors {
-		rs, err := c.Get()
+		rs, err := c.Get(ctx)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("collector name: %v; scan cancelled: %w", c.Name(), ctx.Err())
+		}
 		if err != nil {
 			logrus.Errorf("collector name: %v; Failed to retrieve data from collector: %v", c.Name(), err)
 		} else {
@@ -295,5 +454,5 @@ func getCollectors(collectors []collector.Collector) []map[string]interface{} {
 			logrus.Infof("collector name: %v; Retrieved %d resources from collector", c.Name(), len(rs))
 		}
 	}
-	return inputs
+	return inputs, nil
 }
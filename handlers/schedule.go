@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/leader"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// RunBackgroundWork runs the scheduled scans until ctx is done. With leader election only the
+// replica holding the Lease runs them and prunes the reports, whereas every sharded replica runs
+// the ones of its shard and the first shard prunes the reports.
+func RunBackgroundWork(ctx context.Context) {
+	if !config.LeaderElection || sharded() {
+		if config.Shard == 0 {
+			pruneReports(ctx)
+		}
+		runScheduledScans(ctx)
+		return
+	}
+	leader.NewElector(config.KubeClient.Clientset, leader.Opts{
+		Namespace: config.LeaderElectionNamespace,
+		LeaseName: config.LeaderElectionLease,
+		Identity:  config.LeaderElectionIdentity,
+	}).Run(ctx, func(ctx context.Context) {
+		pruneReports(ctx)
+		runScheduledScans(ctx)
+	})
+}
+
+// runScheduledScans scans the clusters every scan interval, keeping the full scans for the reads
+func runScheduledScans(ctx context.Context) {
+	logrus.Infof("scanning the clusters every %v", config.ScanInterval)
+	ticker := time.NewTicker(config.ScanInterval)
+	defer ticker.Stop()
+	for {
+		scanFleet(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanFleet runs a full scan of every cluster of the shard of the replica
+func scanFleet(ctx context.Context) {
+	clusters := ownClusters(listArgoClusters())
+	start := time.Now()
+	filter := newDeprecationFilter()
+	for i := range clusters {
+		if ctx.Err() != nil {
+			logrus.Warnf("stopping the scheduled scan after %d of %d clusters: %v", i, len(clusters), ctx.Err())
+			return
+		}
+		recordScan(ctx, filter, getDeprecationForCluster(ctx, clusters[i], filter))
+	}
+	logrus.Infof("scheduled scan of %d clusters done in %v", len(clusters), time.Since(start))
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/shard"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// forwardedHeader marks the requests forwarded by another replica with its shard, along with the
+// secret shared by the replicas in forwardedSecretHeader; these are served by the replica itself
+// and never forwarded again
+const (
+	forwardedHeader       = "X-Apid-Helper-Shard"
+	forwardedSecretHeader = "X-Apid-Helper-Shard-Secret"
+)
+
+var shardClient = &http.Client{}
+
+// sharded tells whether the clusters are split between several replicas
+func sharded() bool {
+	return config.ShardReplicas > 1
+}
+
+// forwarded tells whether the request was forwarded by another replica; the header sent by the
+// clients without the shared secret is ignored
+func forwarded(c *gin.Context) bool {
+	return c.GetHeader(forwardedHeader) != "" && config.ShardSecret != "" &&
+		subtle.ConstantTimeCompare([]byte(c.GetHeader(forwardedSecretHeader)), []byte(config.ShardSecret)) == 1
+}
+
+// markForwarded marks a request forwarded to another replica
+func markForwarded(header http.Header) {
+	header.Set(forwardedHeader, strconv.Itoa(config.Shard))
+	header.Set(forwardedSecretHeader, config.ShardSecret)
+}
+
+// ownClusters returns the clusters of the shard of this replica
+func ownClusters(clusters []argoAppV1.Cluster) []argoAppV1.Cluster {
+	if !sharded() {
+		return clusters
+	}
+	owned := make([]argoAppV1.Cluster, 0, len(clusters))
+	for i := range clusters {
+		if shard.Of(&clusters[i], config.ShardReplicas) == config.Shard {
+			owned = append(owned, clusters[i])
+		}
+	}
+	return owned
+}
+
+// RouteToShard forwards the requests of a cluster of another shard to the replica of that shard,
+// which keeps the results of the cluster; the cluster is read from the `clusterName` or `name`
+// path parameter
+func RouteToShard(c *gin.Context) {
+	if !sharded() || forwarded(c) {
+		return
+	}
+	clusterName := c.Param("clusterName")
+	if clusterName == "" {
+		clusterName = c.Param("name")
+	}
+	cluster, found := clusterRegistry.Get(clusterName)
+	if !found {
+		return
+	}
+	owner := shard.Of(cluster, config.ShardReplicas)
+	if owner == config.Shard {
+		return
+	}
+
+	target, err := url.Parse(shard.PeerURL(config.ShardPeerURL, owner))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("invalid url of the replica of shard %d: %v", owner, err),
+		})
+		return
+	}
+	logrus.Debugf("forwarding %s to the replica of shard %d", c.Request.URL.Path, owner)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) {
+		logrus.Errorf("unable to reach the replica of shard %d: %v", owner, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		_ = json.NewEncoder(w).Encode(gin.H{
+			"error": fmt.Sprintf("unable to reach the replica of shard %d serving the %s cluster", owner, clusterName),
+		})
+	}
+	markForwarded(c.Request.Header)
+	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
+
+// gatherShards gets the given URI from the replicas of the other shards in the background and
+// hands their responses over to collect, one at a time. The returned function waits for the
+// replicas and returns the errors of the unreachable shards. Nothing is gathered unless the
+// clusters are sharded and the request comes from a client.
+func gatherShards(c *gin.Context, requestURI string, collect func(body []byte) error) func() []string {
+	if !sharded() || forwarded(c) {
+		return func() []string { return nil }
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []string
+	for peer := 0; peer < config.ShardReplicas; peer++ {
+		if peer == config.Shard {
+			continue
+		}
+		wg.Add(1)
+		go func(peer int) {
+			defer wg.Done()
+			body, err := requestShard(c, peer, requestURI)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				err = collect(body)
+			}
+			if err != nil {
+				logrus.Errorf("unable to gather the results of shard %d: %v", peer, err)
+				errs = append(errs, fmt.Sprintf("shard %d: %v", peer, err))
+			}
+		}(peer)
+	}
+	return func() []string {
+		wg.Wait()
+		return errs
+	}
+}
+
+// requestShard gets the given URI from the replica of the given shard
+func requestShard(c *gin.Context, peer int, requestURI string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet,
+		shard.PeerURL(config.ShardPeerURL, peer)+requestURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	markForwarded(req.Header)
+	resp, err := shardClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return body, nil
+}
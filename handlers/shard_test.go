@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/config"
+)
+
+// setSharding sets the sharding of the replica for the test
+func setSharding(t *testing.T, replicas, shard int, peerURL, secret string) {
+	replicasBefore, shardBefore, peerURLBefore, secretBefore := config.ShardReplicas, config.Shard, config.ShardPeerURL, config.ShardSecret
+	config.ShardReplicas, config.Shard, config.ShardPeerURL, config.ShardSecret = replicas, shard, peerURL, secret
+	t.Cleanup(func() {
+		config.ShardReplicas, config.Shard, config.ShardPeerURL, config.ShardSecret = replicasBefore, shardBefore, peerURLBefore, secretBefore
+	})
+}
+
+func testContext(header http.Header) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1alpha/auditlogs", nil)
+	for name, values := range header {
+		c.Request.Header[name] = values
+	}
+	return c
+}
+
+func TestForwarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		header http.Header
+		want   bool
+	}{
+		{name: "client request", secret: "s3cret", header: http.Header{}, want: false},
+		{name: "forwarded", secret: "s3cret", header: http.Header{forwardedHeader: {"1"}, forwardedSecretHeader: {"s3cret"}}, want: true},
+		{name: "wrong secret", secret: "s3cret", header: http.Header{forwardedHeader: {"1"}, forwardedSecretHeader: {"guess"}}, want: false},
+		{name: "no secret", secret: "s3cret", header: http.Header{forwardedHeader: {"1"}}, want: false},
+		{name: "no shard", secret: "s3cret", header: http.Header{forwardedSecretHeader: {"s3cret"}}, want: false},
+		{name: "no secret configured", secret: "", header: http.Header{forwardedHeader: {"1"}, forwardedSecretHeader: {""}}, want: false},
+	}
+	for _, test := range tests {
+		setSharding(t, 2, 0, "", test.secret)
+		if got := forwarded(testContext(test.header)); got != test.want {
+			t.Errorf("%s: forwarded = %t, want %t", test.name, got, test.want)
+		}
+	}
+
+	// the requests marked by a replica are told apart by the others
+	setSharding(t, 2, 1, "", "s3cret")
+	header := http.Header{}
+	markForwarded(header)
+	if !forwarded(testContext(header)) {
+		t.Errorf("the request marked with %v isn't forwarded", header)
+	}
+}
+
+func TestGatherShards(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(forwardedSecretHeader) != "s3cret" || r.Header.Get(forwardedHeader) != "0" {
+			t.Errorf("unexpected forwarded headers %v", r.Header)
+		}
+		json.NewEncoder(w).Encode(gin.H{"auditResults": []config.DeprecationResults{{ClusterName: "staging"}}})
+	}))
+	defer peer.Close()
+
+	// the peer serves the three other shards
+	setSharding(t, 4, 0, peer.URL, "s3cret")
+	var gathered []string
+	var bodies int
+	waitShards := gatherShards(testContext(http.Header{}), "/v1alpha/auditlogs", func(body []byte) error {
+		var response struct {
+			AuditResults []config.DeprecationResults `json:"auditResults"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return err
+		}
+		bodies++
+		for _, result := range response.AuditResults {
+			gathered = append(gathered, result.ClusterName)
+		}
+		return nil
+	})
+	if unreachable := waitShards(); len(unreachable) != 0 || bodies != 3 || len(gathered) != 3 {
+		t.Errorf("gathered %v from %d shards, unreachable %v", gathered, bodies, unreachable)
+	}
+
+	// the forwarded requests are served by the replica alone
+	header := http.Header{}
+	markForwarded(header)
+	waitShards = gatherShards(testContext(header), "/v1alpha/auditlogs", func(body []byte) error {
+		t.Error("gathered the shards of a forwarded request")
+		return nil
+	})
+	if unreachable := waitShards(); len(unreachable) != 0 {
+		t.Errorf("unexpected unreachable shards %v", unreachable)
+	}
+
+	// the unreachable shards are reported
+	config.ShardPeerURL = "http://127.0.0.1:1"
+	waitShards = gatherShards(testContext(http.Header{}), "/v1alpha/auditlogs", func(body []byte) error { return nil })
+	if unreachable := waitShards(); len(unreachable) != 3 {
+		t.Errorf("got the unreachable shards %v, want 3", unreachable)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/gin-gonic/gin"
+	"github.com/gkarthiks/argo-apid-helper/summary"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"net/http"
+	"strings"
+)
+
+// GetFleetSummary aggregates the last full scans of the clusters per cluster, per deprecated API,
+// per namespace and per Argo project; the clusters never scanned are listed separately
+func GetFleetSummary(c *gin.Context) {
+	ctx := c.Request.Context()
+	records, unreachableShards, err := fleetRecords(c)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	clusters := listArgoClusters()
+	applications, err := PopulateArgoApplications(ctx)
+	if err != nil {
+		logrus.Warnf("unable to attribute the deprecations to argocd projects: %v", err)
+	}
+
+	fleetSummary := summary.Build(records, newProjectResolver(applications, clusters))
+	scanned := sets.NewString()
+	for _, record := range records {
+		scanned.Insert(record.Results.ClusterName)
+	}
+	unscanned := []string{}
+	for _, cluster := range clusters {
+		if !scanned.Has(cluster.Name) {
+			unscanned = append(unscanned, cluster.Name)
+		}
+	}
+
+	response := gin.H{
+		"summary":           fleetSummary,
+		"unscannedClusters": unscanned,
+	}
+	if len(unreachableShards) > 0 {
+		response["unreachableShards"] = unreachableShards
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// newProjectResolver attributes the resources to the projects of the applications deploying them,
+// falling back to the application deploying to the namespace of the resource
+func newProjectResolver(applications []argoAppV1.Application, clusters []argoAppV1.Cluster) summary.ProjectResolver {
+	type resourceKey struct {
+		cluster, kind, namespace, name string
+	}
+	type namespaceKey struct {
+		cluster, namespace string
+	}
+	// the destinations of the applications are resolved within their ArgoCD instance
+	type destinationKey struct {
+		instance, nameOrServer string
+	}
+
+	destinations := make(map[destinationKey]string)
+	for i := range clusters {
+		instance := clusterRegistry.Instance(&clusters[i])
+		destinations[destinationKey{instance: instance, nameOrServer: clusters[i].Server}] = clusters[i].Name
+		destinations[destinationKey{instance: instance, nameOrServer: clusterRegistry.ArgoName(&clusters[i])}] = clusters[i].Name
+	}
+	resolveDestination := func(instance, nameOrServer string) string {
+		if clusterName, found := destinations[destinationKey{instance: instance, nameOrServer: nameOrServer}]; found {
+			return clusterName
+		}
+		// the local cluster belongs to every instance
+		return destinations[destinationKey{nameOrServer: nameOrServer}]
+	}
+
+	resources := make(map[resourceKey]string)
+	namespaces := make(map[namespaceKey]string)
+	for _, application := range applications {
+		destination := application.Spec.Destination
+		nameOrServer := destination.Name
+		if nameOrServer == "" {
+			nameOrServer = strings.TrimRight(destination.Server, "/")
+		}
+		clusterName := resolveDestination(application.Namespace, nameOrServer)
+		for _, resource := range application.Status.Resources {
+			resources[resourceKey{cluster: clusterName, kind: resource.Kind, namespace: resource.Namespace, name: resource.Name}] = application.Spec.Project
+		}
+		key := namespaceKey{cluster: clusterName, namespace: destination.Namespace}
+		if _, found := namespaces[key]; !found && destination.Namespace != "" {
+			namespaces[key] = application.Spec.Project
+		}
+	}
+
+	return func(clusterName, kind, namespace, name string) string {
+		if project, found := resources[resourceKey{cluster: clusterName, kind: kind, namespace: namespace, name: name}]; found {
+			return project
+		}
+		return namespaces[namespaceKey{cluster: clusterName, namespace: namespace}]
+	}
+}
@@ -0,0 +1,139 @@
+package leader
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sync"
+	"time"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// Opts locates the Lease the replicas compete for
+type Opts struct {
+	Namespace string
+	LeaseName string
+	// Identity of the replica, e.g. its pod name
+	Identity string
+}
+
+// Elector runs the background work of the replica holding the Lease; every replica takes part in
+// the election again after losing the Lease until the context is done
+type Elector struct {
+	clientset kubernetes.Interface
+	opts      Opts
+}
+
+func NewElector(clientset kubernetes.Interface, opts Opts) *Elector {
+	return &Elector{clientset: clientset, opts: opts}
+}
+
+// Run runs work whenever the replica holds the Lease, cancelling the context of work as soon as
+// the Lease is lost or ctx is done; it returns once ctx is done, work has returned and the Lease
+// is released. The Lease is renewed until work has returned, so that the next leader never runs
+// alongside it.
+func (e *Elector) Run(ctx context.Context, work func(ctx context.Context)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Namespace: e.opts.Namespace, Name: e.opts.LeaseName},
+		Client:    e.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: e.opts.Identity,
+		},
+	}
+
+	for ctx.Err() == nil {
+		term := &term{done: make(chan struct{})}
+		// the election outlives ctx until the work of the term has returned, releasing the
+		// Lease only then
+		electionCtx, stopElection := context.WithCancel(context.Background())
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            e.opts.LeaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leadCtx context.Context) {
+					if !term.start() {
+						return
+					}
+					defer close(term.done)
+					workCtx, cancel := context.WithCancel(leadCtx)
+					defer cancel()
+					go func() {
+						select {
+						case <-ctx.Done():
+							cancel()
+						case <-workCtx.Done():
+						}
+					}()
+					logrus.Infof("%s holds the %s/%s lease, running the background work", e.opts.Identity, e.opts.Namespace, e.opts.LeaseName)
+					work(workCtx)
+				},
+				OnStoppedLeading: func() {
+					logrus.Infof("%s no longer holds the %s/%s lease", e.opts.Identity, e.opts.Namespace, e.opts.LeaseName)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != e.opts.Identity {
+						logrus.Infof("%s leads the background work", identity)
+					}
+				},
+			},
+		})
+		if err != nil {
+			stopElection()
+			logrus.Errorf("unable to take part in the leader election: %v", err)
+			return
+		}
+		elected := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				term.wait()
+				stopElection()
+			case <-elected:
+			}
+		}()
+		elector.Run(electionCtx)
+		close(elected)
+		stopElection()
+		term.wait()
+	}
+}
+
+// term follows the work of a term of the replica; the leader elector starts the work in its own
+// goroutine, possibly after the term is over
+type term struct {
+	mu      sync.Mutex
+	started bool
+	over    bool
+	done    chan struct{}
+}
+
+// start tells whether the work of the term may start, i.e. the term isn't over yet
+func (t *term) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.started = !t.over
+	return t.started
+}
+
+// wait ends the term and waits for its work, if started
+func (t *term) wait() {
+	t.mu.Lock()
+	t.over = true
+	started := t.started
+	t.mu.Unlock()
+	if started {
+		<-t.done
+	}
+}
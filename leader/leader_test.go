@@ -0,0 +1,142 @@
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testOpts = Opts{Namespace: "apid-helper", LeaseName: "apid-helper-leader"}
+
+// holder returns the holder of the Lease, empty when the Lease is missing or released
+func holder(clientset kubernetes.Interface) string {
+	lease, err := clientset.CoordinationV1().Leases(testOpts.Namespace).Get(context.Background(), testOpts.LeaseName, metav1.GetOptions{})
+	if err != nil || lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func receive(t *testing.T, ch <-chan struct{}, description string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(3 * retryPeriod):
+		t.Fatalf("timed out waiting for %s", description)
+	}
+}
+
+func TestTerm(t *testing.T) {
+	// a started term waits for its work
+	started := &term{done: make(chan struct{})}
+	if !started.start() {
+		t.Fatal("the work of a new term didn't start")
+	}
+	waited := make(chan struct{})
+	go func() {
+		started.wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("the term didn't wait for its work")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(started.done)
+	receive(t, waited, "the end of the term")
+
+	// the work of a term that is over never starts
+	over := &term{done: make(chan struct{})}
+	over.wait()
+	if over.start() {
+		t.Error("the work started after the end of the term")
+	}
+}
+
+func TestElectorReleasesAfterWork(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	opts := testOpts
+	opts.Identity = "apid-helper-0"
+	ctx, cancel := context.WithCancel(context.Background())
+	running := make(chan struct{})
+	var heldDuringShutdown string
+	go func() {
+		<-running
+		cancel()
+	}()
+
+	NewElector(clientset, opts).Run(ctx, func(workCtx context.Context) {
+		close(running)
+		<-workCtx.Done()
+		// the Lease is kept while the work winds down
+		time.Sleep(50 * time.Millisecond)
+		heldDuringShutdown = holder(clientset)
+	})
+	if heldDuringShutdown != opts.Identity {
+		t.Errorf("the lease was held by %q while the work wound down, want %s", heldDuringShutdown, opts.Identity)
+	}
+	if current := holder(clientset); current != "" {
+		t.Errorf("the lease is still held by %q after Run returned", current)
+	}
+}
+
+func TestElectorHandoff(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	first, second := testOpts, testOpts
+	first.Identity, second.Identity = "apid-helper-0", "apid-helper-1"
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstRunning, firstDone := make(chan struct{}), make(chan struct{})
+	var firstFinished atomic.Bool
+	go func() {
+		defer close(firstDone)
+		NewElector(clientset, first).Run(firstCtx, func(workCtx context.Context) {
+			close(firstRunning)
+			<-workCtx.Done()
+			time.Sleep(100 * time.Millisecond)
+			firstFinished.Store(true)
+		})
+	}()
+	receive(t, firstRunning, "the work of the first replica")
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	secondRunning, secondDone := make(chan struct{}), make(chan struct{})
+	var overlapped atomic.Bool
+	go func() {
+		defer close(secondDone)
+		NewElector(clientset, second).Run(secondCtx, func(workCtx context.Context) {
+			overlapped.Store(!firstFinished.Load())
+			close(secondRunning)
+			<-workCtx.Done()
+		})
+	}()
+
+	// the second replica waits for the lease while the first one holds it
+	select {
+	case <-secondRunning:
+		t.Fatal("the second replica ran alongside the first one")
+	case <-time.After(2 * retryPeriod):
+	}
+	if current := holder(clientset); current != first.Identity {
+		t.Errorf("the lease is held by %q, want %s", current, first.Identity)
+	}
+
+	// the lease is handed over once the work of the first replica has returned
+	stopFirst()
+	receive(t, firstDone, "the first replica to stop")
+	receive(t, secondRunning, "the work of the second replica")
+	if overlapped.Load() {
+		t.Error("the second replica started before the work of the first one returned")
+	}
+	if current := holder(clientset); current != second.Identity {
+		t.Errorf("the lease is held by %q, want %s", current, second.Identity)
+	}
+	stopSecond()
+	receive(t, secondDone, "the second replica to stop")
+}
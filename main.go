@@ -6,6 +6,7 @@ import (
 	"github.com/gkarthiks/argo-apid-helper/handlers"
 	"github.com/sirupsen/logrus"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,7 +19,6 @@ func init() {
 	config.InitializeLogger()
 	config.InitializeRouter()
 	config.InitializeKubeClient()
-	handlers.PopulateArgoClusterNames(context.Background())
 }
 
 func main() {
@@ -29,13 +29,51 @@ func main() {
 
 	v1alpha := config.Router.Group("/v1alpha")
 	v1alpha.GET("/clusters", handlers.GetArgoClusters)
+	v1alpha.GET("/clusters/:name", handlers.RouteToShard, handlers.GetArgoCluster)
 
 	v1alpha.GET("/deprecations", handlers.ListAPIDeprecations)
-	v1alpha.GET("/:clusterName/deprecations", handlers.GetTargetClusterDeprecations)
+	v1alpha.GET("/:clusterName/deprecations", handlers.RouteToShard, handlers.GetTargetClusterDeprecations)
+	v1alpha.GET("/:clusterName/psp-migration", handlers.RouteToShard, handlers.GetPSPMigration)
+	v1alpha.GET("/readiness", handlers.GetFleetReadiness)
+	v1alpha.GET("/summary", handlers.GetFleetSummary)
+	v1alpha.GET("/scans", handlers.ListScans)
+	v1alpha.GET("/:clusterName/readiness", handlers.RouteToShard, handlers.GetClusterReadiness)
 
+	v1alpha.GET("/auditlogs", handlers.ListAuditLogDeprecations)
+	v1alpha.GET("/:clusterName/auditlogs", handlers.RouteToShard, handlers.GetAuditLogDeprecations)
+	v1alpha.POST("/:clusterName/auditlogs", handlers.RouteToShard, handlers.IngestAuditLog)
+
+	// every request context derives from scanCtx, cancelling it on shutdown
+	// aborts the in-flight cluster scans instead of waiting them out
+	scanCtx, cancelScans := context.WithCancel(context.Background())
 	server := &http.Server{
 		Addr:    ":" + config.ServerPort,
 		Handler: config.Router,
+		BaseContext: func(net.Listener) context.Context {
+			return scanCtx
+		},
+	}
+
+	if err := handlers.InitResultStore(scanCtx); err != nil {
+		logrus.Fatalf("unable to set up the %s result store: %v", config.ResultStore, err)
+	}
+	if err := handlers.InitReportWriter(); err != nil {
+		logrus.Fatalf("unable to write the deprecation reports: %v", err)
+	}
+	if err := handlers.WatchClusters(scanCtx); err != nil {
+		logrus.Fatalf("unable to watch the clusters: %v", err)
+	}
+	if config.AuditLogDir != "" {
+		go handlers.WatchAuditLogs(scanCtx)
+	}
+	backgroundWork := make(chan struct{})
+	if config.ScanInterval > 0 {
+		go func() {
+			defer close(backgroundWork)
+			handlers.RunBackgroundWork(scanCtx)
+		}()
+	} else {
+		close(backgroundWork)
 	}
 
 	logrus.Infof("configuring the apid server on %s port", config.ServerPort)
@@ -49,11 +87,18 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logrus.Info("Shutdown Server ...")
+	cancelScans()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		logrus.Fatalf("Server Shutdown: %s", err)
 	}
+	// the background work releases the leader Lease on its way out
+	select {
+	case <-backgroundWork:
+	case <-ctx.Done():
+		logrus.Warn("the background work didn't stop in time")
+	}
 	logrus.Info("Server exiting ...")
 }
@@ -0,0 +1,205 @@
+package readiness
+
+import (
+	"fmt"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/analysis"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	StatusReady    = "ready"
+	StatusWarnings = "warnings"
+	StatusBlocked  = "blocked"
+)
+
+// ruleSetRemovedIn reads the removal release from the rule set names, e.g. `Deprecated APIs removed in 1.25`
+var ruleSetRemovedIn = regexp.MustCompile(`removed in (\d+\.\d+)`)
+
+// statusRank orders the statuses by risk
+var statusRank = map[string]int{
+	StatusBlocked:  2,
+	StatusWarnings: 1,
+	StatusReady:    0,
+}
+
+// Readiness is the upgrade readiness of a cluster for a target version. A cluster is blocked when it
+// uses APIs, fields or clients removed by the target version or a node doesn't support it, has
+// warnings when anything else was found or couldn't be collected, and is ready otherwise.
+type Readiness struct {
+	ClusterName    string            `json:"clusterName"`
+	ClusterLabels  map[string]string `json:"clusterLabels,omitempty"`
+	ServerVersion  string            `json:"serverVersion,omitempty"`
+	TargetVersion  string            `json:"targetVersion,omitempty"`
+	Status         string            `json:"status"`
+	RemovedAPIs    int               `json:"removedAPIs"`
+	DeprecatedAPIs int               `json:"deprecatedAPIs"`
+	// FieldDeprecations counts the deprecated fields, annotations and labels
+	FieldDeprecations int `json:"fieldDeprecations"`
+	// BlockingFindings counts the other findings preventing the upgrade to the target version
+	BlockingFindings int `json:"blockingFindings"`
+	// Warnings counts the other findings to look at before the upgrade
+	Warnings int `json:"warnings"`
+	// CollectionGaps counts the parts of the scan that failed, a failed scan counting as one
+	CollectionGaps int        `json:"collectionGaps"`
+	ScannedAt      *time.Time `json:"scannedAt,omitempty"`
+}
+
+// Evaluate computes the readiness of the scanned cluster for the target version, defaulting to
+// the next minor version of the cluster
+func Evaluate(record store.Record, targetVersion string) Readiness {
+	results := record.Results
+	readiness := Readiness{
+		ClusterName:   results.ClusterName,
+		ClusterLabels: results.ClusterLabels,
+		ServerVersion: results.ServerVersion,
+	}
+	if !record.ScannedAt.IsZero() {
+		scannedAt := record.ScannedAt
+		readiness.ScannedAt = &scannedAt
+	}
+
+	target, _ := utilversion.ParseGeneric(targetVersion)
+	if target == nil {
+		if serverVersion, err := utilversion.ParseGeneric(results.ServerVersion); err == nil {
+			target = utilversion.MustParseGeneric(fmt.Sprintf("%d.%d", serverVersion.Major(), serverVersion.Minor()+1))
+		}
+	}
+	if target != nil {
+		readiness.TargetVersion = target.String()
+	}
+	// removedBy tells whether a removal release is reached by the target version; every
+	// removal counts when the target is unknown
+	removedBy := func(release string) bool {
+		if release == "" {
+			return false
+		}
+		removal, err := utilversion.ParseGeneric(release)
+		return err == nil && (target == nil || target.AtLeast(removal))
+	}
+
+	switch result := results.Result.(type) {
+	case []judge.Result:
+		result = DeprecatedBy(result, readiness.TargetVersion)
+		for i := range result {
+			if removedBy(JudgedRemovalRelease(&result[i])) {
+				readiness.RemovedAPIs++
+			} else {
+				readiness.DeprecatedAPIs++
+			}
+		}
+	case nil:
+		// nothing judged, e.g. none of the asked namespaces are accessible
+	default:
+		// the scan of the cluster failed and the result holds the error
+		readiness.CollectionGaps++
+	}
+	readiness.CollectionGaps += len(results.CollectionErrors)
+
+	readiness.FieldDeprecations = len(results.FieldFindings)
+	for _, finding := range results.FieldFindings {
+		if removedBy(finding.RemovedIn) {
+			readiness.BlockingFindings++
+		}
+	}
+	for _, requestedAPI := range results.RequestedDeprecatedAPIs {
+		if removedBy(requestedAPI.RemovedRelease) {
+			readiness.BlockingFindings++
+		} else {
+			readiness.Warnings++
+		}
+	}
+	for _, finding := range results.RegistrationFindings {
+		if removedBy(finding.RemovedIn) {
+			readiness.BlockingFindings++
+		} else {
+			readiness.Warnings++
+		}
+	}
+	for _, finding := range nodeFindings(results, readiness.TargetVersion) {
+		if finding.Blocking {
+			readiness.BlockingFindings++
+		} else {
+			readiness.Warnings++
+		}
+	}
+	readiness.Warnings += len(results.ServerWarnings) + len(results.CRDFindings) + len(results.ImageFindings)
+
+	switch {
+	case readiness.RemovedAPIs > 0 || readiness.BlockingFindings > 0:
+		readiness.Status = StatusBlocked
+	case readiness.DeprecatedAPIs > 0 || readiness.FieldDeprecations > 0 || readiness.Warnings > 0 || readiness.CollectionGaps > 0:
+		readiness.Status = StatusWarnings
+	default:
+		readiness.Status = StatusReady
+	}
+	return readiness
+}
+
+// nodeFindings checks the versions of the nodes against the target version, the node findings
+// of the scan being blocking for the target of the scan; the scans without the node versions
+// keep their findings
+func nodeFindings(results *config.DeprecationResults, targetVersion string) []analysis.NodeFinding {
+	if len(results.Nodes) == 0 {
+		return results.NodeFindings
+	}
+	findings := analysis.CheckNodeVersions(results.Nodes, results.ServerVersion, targetVersion)
+	for _, finding := range results.NodeFindings {
+		if finding.Check == analysis.NodeCheckDeprecatedLabel {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// DeprecatedBy returns the judged results of the APIs deprecated in the given version, the scans
+// keeping the APIs deprecated after the version of the cluster to check them against any target;
+// every result is kept when the version is unknown
+func DeprecatedBy(results []judge.Result, version string) []judge.Result {
+	target, err := judge.NewVersion(version)
+	if err != nil {
+		return results
+	}
+	deprecated := make([]judge.Result, 0, len(results))
+	for _, result := range results {
+		if result.Since == nil || !result.Since.GreaterThan(target.Version) {
+			deprecated = append(deprecated, result)
+		}
+	}
+	return deprecated
+}
+
+// JudgedRemovalRelease returns the release removing a judged API, taken from the rule set and
+// falling back to the removed group/versions
+func JudgedRemovalRelease(result *judge.Result) string {
+	if match := ruleSetRemovedIn.FindStringSubmatch(result.RuleSet); match != nil {
+		return match[1]
+	}
+	return analysis.RemovedGroupVersions[result.ApiVersion]
+}
+
+// SortByRisk orders the clusters by status, then by the number of blockers, warnings and
+// collection gaps, the riskiest first
+func SortByRisk(clusters []Readiness) {
+	sort.SliceStable(clusters, func(i, j int) bool {
+		a, b := clusters[i], clusters[j]
+		if statusRank[a.Status] != statusRank[b.Status] {
+			return statusRank[a.Status] > statusRank[b.Status]
+		}
+		if blockers := a.RemovedAPIs + a.BlockingFindings - b.RemovedAPIs - b.BlockingFindings; blockers != 0 {
+			return blockers > 0
+		}
+		if warnings := a.DeprecatedAPIs + a.FieldDeprecations + a.Warnings - b.DeprecatedAPIs - b.FieldDeprecations - b.Warnings; warnings != 0 {
+			return warnings > 0
+		}
+		if a.CollectionGaps != b.CollectionGaps {
+			return a.CollectionGaps > b.CollectionGaps
+		}
+		return a.ClusterName < b.ClusterName
+	})
+}
@@ -0,0 +1,105 @@
+package readiness
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	goversion "github.com/hashicorp/go-version"
+)
+
+func judgedResult(name, kind, apiVersion, since, removedIn string) judge.Result {
+	return judge.Result{
+		Name:       name,
+		Kind:       kind,
+		ApiVersion: apiVersion,
+		RuleSet:    "Deprecated APIs removed in " + removedIn,
+		Since:      goversion.Must(goversion.NewVersion(since)),
+	}
+}
+
+func TestEvaluateTargetVersion(t *testing.T) {
+	// the scans keep the APIs deprecated after the version of the cluster
+	record := func(serverVersion string, results ...judge.Result) store.Record {
+		return store.Record{
+			Results:   &config.DeprecationResults{ClusterName: "prod", ServerVersion: serverVersion, Result: results},
+			ScannedAt: time.Now(),
+		}
+	}
+	hpa := judgedResult("web", "HorizontalPodAutoscaler", "autoscaling/v2beta2", "1.23.0", "1.26")
+	flowSchema := judgedResult("catch-all", "FlowSchema", "flowcontrol.apiserver.k8s.io/v1beta2", "1.26.0", "1.29")
+	ingress := judgedResult("shop", "Ingress", "extensions/v1beta1", "1.14.0", "1.22")
+
+	tests := []struct {
+		name           string
+		record         store.Record
+		targetVersion  string
+		wantTarget     string
+		wantStatus     string
+		wantRemoved    int
+		wantDeprecated int
+	}{
+		{
+			name:          "deprecated after the cluster version, removed by the target",
+			record:        record("1.22.4", hpa),
+			targetVersion: "1.26",
+			wantTarget:    "1.26", wantStatus: StatusBlocked, wantRemoved: 1,
+		},
+		{
+			name:       "deprecated by the next minor version",
+			record:     record("1.22.4", hpa),
+			wantTarget: "1.23", wantStatus: StatusWarnings, wantDeprecated: 1,
+		},
+		{
+			name:          "deprecated after the target",
+			record:        record("1.25.2", flowSchema),
+			targetVersion: "1.25.9",
+			wantTarget:    "1.25.9", wantStatus: StatusReady,
+		},
+		{
+			name:          "deprecated and removed after the cluster version",
+			record:        record("1.25.2", flowSchema, hpa),
+			targetVersion: "1.29",
+			wantTarget:    "1.29", wantStatus: StatusBlocked, wantRemoved: 2,
+		},
+		{
+			name:          "removed before the cluster version",
+			record:        record("1.25.2", ingress, flowSchema),
+			targetVersion: "1.28",
+			wantTarget:    "1.28", wantStatus: StatusBlocked, wantRemoved: 1, wantDeprecated: 1,
+		},
+	}
+	for _, test := range tests {
+		readiness := Evaluate(test.record, test.targetVersion)
+		if readiness.TargetVersion != test.wantTarget || readiness.Status != test.wantStatus ||
+			readiness.RemovedAPIs != test.wantRemoved || readiness.DeprecatedAPIs != test.wantDeprecated {
+			t.Errorf("%s: got the %s readiness for %s with %d removed and %d deprecated apis, want %s for %s with %d and %d",
+				test.name, readiness.Status, readiness.TargetVersion, readiness.RemovedAPIs, readiness.DeprecatedAPIs,
+				test.wantStatus, test.wantTarget, test.wantRemoved, test.wantDeprecated)
+		}
+	}
+}
+
+func TestDeprecatedBy(t *testing.T) {
+	results := []judge.Result{
+		judgedResult("shop", "Ingress", "extensions/v1beta1", "1.14.0", "1.22"),
+		judgedResult("web", "HorizontalPodAutoscaler", "autoscaling/v2beta2", "1.23.0", "1.26"),
+		{Name: "legacy", Kind: "Widget", ApiVersion: "example.com/v1alpha1", RuleSet: "Custom"},
+	}
+	tests := []struct {
+		version string
+		want    int
+	}{
+		{version: "1.22.4", want: 2},
+		{version: "1.23", want: 3},
+		{version: "", want: 3},
+		{version: "not a version", want: 3},
+	}
+	for _, test := range tests {
+		if got := DeprecatedBy(results, test.version); len(got) != test.want {
+			t.Errorf("DeprecatedBy(%s) = %+v, want %d results", test.version, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+)
+
+// SourceArgoCD names the source of the clusters of the ArgoCD cluster secrets
+const SourceArgoCD = "argocd"
+
+// WatchOpts tells which cluster secrets to watch
+type WatchOpts struct {
+	// Namespaces are the namespaces of the ArgoCD instances
+	Namespaces []string
+	// NamespaceSelector adds the namespaces matching the label selector to the watched ones
+	NamespaceSelector string
+	// SecretSelector is the label selector of the cluster secrets
+	SecretSelector string
+}
+
+// ArgoCDSource registers the clusters of the ArgoCD cluster secrets keyed by the secret UID, kept
+// up to date by informers on the secrets. Every cluster is tagged with its ArgoCD instance, i.e.
+// the namespace of its secret.
+type ArgoCDSource struct {
+	clientset kubernetes.Interface
+	opts      WatchOpts
+
+	mu sync.RWMutex
+	// namespaces are the configured namespaces of the ArgoCD instances and selected the ones
+	// currently matching the namespace selector
+	namespaces sets.String
+	selected   sets.String
+}
+
+func NewArgoCDSource(clientset kubernetes.Interface, opts WatchOpts) *ArgoCDSource {
+	return &ArgoCDSource{
+		clientset:  clientset,
+		opts:       opts,
+		namespaces: sets.NewString(opts.Namespaces...),
+		selected:   sets.NewString(),
+	}
+}
+
+func (s *ArgoCDSource) Name() string {
+	return SourceArgoCD
+}
+
+// Start starts the informers on the cluster secrets of the ArgoCD instances and returns once the
+// registry holds the existing secrets; the informers stop along with ctx. The secrets of every
+// namespace are watched when a namespace selector is given, keeping only the ones of the
+// configured and the selected namespaces.
+func (s *ArgoCDSource) Start(ctx context.Context, r *Registry) error {
+	var synced []cache.InformerSynced
+	if s.opts.NamespaceSelector == "" {
+		for _, namespace := range s.opts.Namespaces {
+			_, secretsSynced := s.watchSecrets(ctx, r, namespace)
+			synced = append(synced, secretsSynced)
+		}
+	} else {
+		secretInformer, secretsSynced := s.watchSecrets(ctx, r, metav1.NamespaceAll)
+		factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, 0,
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = s.opts.NamespaceSelector
+			}))
+		namespaceInformer := factory.Core().V1().Namespaces().Informer()
+		namespaceSync := newHandlerSync()
+		namespaceInformer.AddEventHandler(namespaceSync.wrap(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if namespace, ok := obj.(*v1.Namespace); ok {
+					s.selectNamespace(r, namespace.Name, secretInformer.GetStore())
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if namespace, ok := obj.(*v1.Namespace); ok {
+					s.unselectNamespace(r, namespace.Name)
+				}
+			},
+		}))
+		factory.Start(ctx.Done())
+		synced = append(synced, secretsSynced, namespaceSync.hasSynced(namespaceInformer))
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("cluster secrets of the %v namespaces were not synced", s.opts.Namespaces)
+	}
+	logrus.Infof("watching the cluster secrets of the %v namespaces; namespace selector: '%s'", s.opts.Namespaces, s.opts.NamespaceSelector)
+	return nil
+}
+
+func (s *ArgoCDSource) watchSecrets(ctx context.Context, r *Registry, namespace string) (cache.SharedIndexInformer, cache.InformerSynced) {
+	factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = s.opts.SecretSelector
+		}))
+	informer := factory.Core().V1().Secrets().Informer()
+	handlerSync := newHandlerSync()
+	informer.AddEventHandler(handlerSync.wrap(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if secret, ok := obj.(*v1.Secret); ok {
+				s.upsert(r, secret)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if secret, ok := obj.(*v1.Secret); ok {
+				s.upsert(r, secret)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if secret, ok := obj.(*v1.Secret); ok {
+				r.Delete(secret.UID)
+			}
+		},
+	}))
+	factory.Start(ctx.Done())
+	return informer, handlerSync.hasSynced(informer)
+}
+
+// selectNamespace accepts the secrets of a namespace matching the namespace selector and
+// registers the ones already known to the informer
+func (s *ArgoCDSource) selectNamespace(r *Registry, namespace string, secrets cache.Store) {
+	s.mu.Lock()
+	s.selected.Insert(namespace)
+	s.mu.Unlock()
+	logrus.Infof("watching the cluster secrets of the selected %s namespace", namespace)
+
+	for _, obj := range secrets.List() {
+		if secret, ok := obj.(*v1.Secret); ok && secret.Namespace == namespace {
+			s.upsert(r, secret)
+		}
+	}
+}
+
+// unselectNamespace drops the clusters of a namespace no longer matching the namespace selector
+func (s *ArgoCDSource) unselectNamespace(r *Registry, namespace string) {
+	s.mu.Lock()
+	s.selected.Delete(namespace)
+	configured := s.namespaces.Has(namespace)
+	s.mu.Unlock()
+	if configured {
+		return
+	}
+	logrus.Infof("dropping the clusters of the %s namespace", namespace)
+	r.DeleteInstance(SourceArgoCD, namespace)
+}
+
+// upsert registers the cluster of the secret; secrets that can't be converted or are outside of
+// the watched namespaces are dropped
+func (s *ArgoCDSource) upsert(r *Registry, secret *v1.Secret) {
+	s.mu.RLock()
+	watched := s.namespaces.Has(secret.Namespace) || s.selected.Has(secret.Namespace)
+	s.mu.RUnlock()
+	if !watched {
+		return
+	}
+	cluster, err := SecretToCluster(secret)
+	if err != nil || cluster == nil {
+		logrus.Errorf("unable to convert cluster secret to cluster object '%s': %v", secret.Name, err)
+		r.Delete(secret.UID)
+		return
+	}
+	r.Register(SourceArgoCD, Registration{UID: secret.UID, Cluster: *cluster, Instance: secret.Namespace})
+}
+
+// Instances returns the namespaces of the watched ArgoCD instances
+func (s *ArgoCDSource) Instances() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.namespaces.Union(s.selected).List()
+}
@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestArgoCDSource(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		clusterSecret("argocd", "cluster-prod", "uid-prod", "prod", "https://prod.example.com"),
+		clusterSecret("team-a", "cluster-team", "uid-team", "team", "https://team.example.com"),
+		// the secrets of the namespaces that aren't watched are left out
+		clusterSecret("default", "cluster-dev", "uid-dev", "dev", "https://dev.example.com"),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := New()
+	source := NewArgoCDSource(clientset, WatchOpts{Namespaces: []string{"argocd", "team-a"}})
+	if err := source.Start(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	// the existing secrets are registered once Start returns
+	assertClusters(t, r, "prod=uid-prod", "team=uid-team")
+	if cluster, _ := r.Get("team@team-a"); r.Instance(cluster) != "team-a" || r.Source(cluster) != SourceArgoCD {
+		t.Errorf("unexpected instance %q and source %q of team@team-a", r.Instance(cluster), r.Source(cluster))
+	}
+
+	secrets := clientset.CoreV1().Secrets("argocd")
+	staging := clusterSecret("argocd", "cluster-staging", "uid-staging", "staging", "https://staging.example.com")
+	if _, err := secrets.Create(ctx, staging, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the added staging cluster", func() bool {
+		_, found := r.Get("staging")
+		return found
+	})
+
+	staging.Data["server"] = []byte("https://staging-eu.example.com")
+	if _, err := secrets.Update(ctx, staging, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the updated staging cluster", func() bool {
+		cluster, found := r.Get("staging")
+		return found && cluster.Server == "https://staging-eu.example.com"
+	})
+
+	// a secret that can't be converted drops its cluster
+	staging.Data["config"] = []byte("{not json")
+	if _, err := secrets.Update(ctx, staging, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the dropped staging cluster", func() bool {
+		_, found := r.Get("staging")
+		return !found
+	})
+
+	if err := secrets.Delete(ctx, "cluster-prod", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the deleted prod cluster", func() bool {
+		return len(r.Clusters()) == 1
+	})
+	assertClusters(t, r, "team=uid-team")
+}
+
+func TestArgoCDSourceNamespaceSelector(t *testing.T) {
+	selected := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"argocd": "true"}}}
+	clientset := fake.NewSimpleClientset(
+		selected,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		clusterSecret("argocd", "cluster-prod", "uid-prod", "prod", "https://prod.example.com"),
+		clusterSecret("team-a", "cluster-team", "uid-team", "team", "https://team.example.com"),
+		clusterSecret("default", "cluster-dev", "uid-dev", "dev", "https://dev.example.com"),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := New()
+	source := NewArgoCDSource(clientset, WatchOpts{Namespaces: []string{"argocd"}, NamespaceSelector: "argocd=true"})
+	if err := source.Start(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the clusters of the selected namespace", func() bool {
+		return len(r.Clusters()) == 2
+	})
+	assertClusters(t, r, "prod=uid-prod", "team=uid-team")
+	if instances := source.Instances(); len(instances) != 2 || instances[0] != "argocd" || instances[1] != "team-a" {
+		t.Errorf("unexpected instances %v", instances)
+	}
+
+	// the clusters of a namespace leaving the selection are dropped
+	if err := clientset.CoreV1().Namespaces().Delete(ctx, "team-a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the dropped clusters of team-a", func() bool {
+		return len(r.Clusters()) == 1
+	})
+	assertClusters(t, r, "prod=uid-prod")
+	if instances := source.Instances(); len(instances) != 1 {
+		t.Errorf("unexpected instances %v", instances)
+	}
+}
@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"context"
+	"github.com/gkarthiks/argo-apid-helper/argoapi"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+	"time"
+)
+
+// SourceArgoCDAPI names the source of the clusters listed by the ArgoCD API server
+const SourceArgoCDAPI = "argocd-api"
+
+// ArgoCDAPISource registers the clusters listed by the ArgoCD API server, polled every poll
+// interval. The API server never hands out the cluster credentials, hence the clusters are
+// scanned through the API server as well; they belong to the single instance behind the API
+// server and carry no instance.
+type ArgoCDAPISource struct {
+	client       *argoapi.Client
+	pollInterval time.Duration
+}
+
+func NewArgoCDAPISource(client *argoapi.Client, pollInterval time.Duration) *ArgoCDAPISource {
+	return &ArgoCDAPISource{client: client, pollInterval: pollInterval}
+}
+
+func (s *ArgoCDAPISource) Name() string {
+	return SourceArgoCDAPI
+}
+
+// Start registers the clusters listed by the API server and keeps polling them until ctx is done
+func (s *ArgoCDAPISource) Start(ctx context.Context, r *Registry) error {
+	if err := s.sync(ctx, r); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.sync(ctx, r); err != nil && ctx.Err() == nil {
+					logrus.Errorf("unable to list the argocd clusters, keeping the known clusters: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *ArgoCDAPISource) sync(ctx context.Context, r *Registry) error {
+	clusters, err := s.client.ListClusters(ctx)
+	if err != nil {
+		return err
+	}
+	registrations := make([]Registration, 0, len(clusters))
+	for _, cluster := range clusters {
+		if cluster.ServerVersion == "" {
+			cluster.ServerVersion = cluster.Info.ServerVersion
+		}
+		if cluster.ConnectionState.Status == "" {
+			cluster.ConnectionState = cluster.Info.ConnectionState
+		}
+		registrations = append(registrations, Registration{UID: types.UID(SourceArgoCDAPI + ":" + cluster.Server), Cluster: cluster})
+	}
+	r.Sync(SourceArgoCDAPI, registrations)
+	return nil
+}
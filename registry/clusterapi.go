@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"time"
+)
+
+const (
+	// SourceClusterAPI names the source of the clusters of the Cluster API kubeconfig secrets
+	SourceClusterAPI = "clusterapi"
+	// clusterAPIKubeconfigKey holds the kubeconfig in the <cluster>-kubeconfig secrets
+	clusterAPIKubeconfigKey = "value"
+	// clusterAPIResync reads the kubeconfig secrets again, the kubeconfigs being rotated by
+	// Cluster API and the secrets of the new clusters being created after their Cluster object
+	clusterAPIResync = 10 * time.Minute
+)
+
+// ClusterAPIClusterResource is the Cluster object of a Cluster API workload cluster
+var ClusterAPIClusterResource = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"}
+
+// ClusterAPISource registers the workload clusters of Cluster API from the <cluster>-kubeconfig
+// secrets it maintains. The Cluster objects are watched through their metadata and the kubeconfig
+// secret of every cluster is read by name, leaving the other secrets of the clusters, like their
+// CA keys, out of the helper. Every cluster is tagged with the clusterapi.<namespace> instance,
+// the namespace of its Cluster object.
+type ClusterAPISource struct {
+	clientset      kubernetes.Interface
+	metadataClient metadata.Interface
+	// namespace of the Cluster objects, every namespace when empty
+	namespace string
+}
+
+func NewClusterAPISource(clientset kubernetes.Interface, metadataClient metadata.Interface, namespace string) *ClusterAPISource {
+	return &ClusterAPISource{clientset: clientset, metadataClient: metadataClient, namespace: namespace}
+}
+
+func (s *ClusterAPISource) Name() string {
+	return SourceClusterAPI
+}
+
+// Start starts the informer on the Cluster objects and returns once the registry holds the
+// existing clusters; the informer stops along with ctx
+func (s *ClusterAPISource) Start(ctx context.Context, r *Registry) error {
+	factory := metadatainformer.NewFilteredSharedInformerFactory(s.metadataClient, clusterAPIResync, s.namespace, nil)
+	informer := factory.ForResource(ClusterAPIClusterResource).Informer()
+	handlerSync := newHandlerSync()
+	informer.AddEventHandler(handlerSync.wrap(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cluster, ok := obj.(*metav1.PartialObjectMetadata); ok {
+				s.upsert(ctx, r, cluster)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if cluster, ok := obj.(*metav1.PartialObjectMetadata); ok {
+				s.upsert(ctx, r, cluster)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if cluster, ok := obj.(*metav1.PartialObjectMetadata); ok {
+				r.Delete(cluster.UID)
+			}
+		},
+	}))
+	factory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), handlerSync.hasSynced(informer)) {
+		return fmt.Errorf("cluster api clusters were not synced")
+	}
+	logrus.Infof("watching the cluster api clusters; namespace: '%s'", s.namespace)
+	return nil
+}
+
+// upsert registers the cluster under its name, reached with the current context of its
+// kubeconfig secret; the clusters without a kubeconfig secret yet are dropped
+func (s *ClusterAPISource) upsert(ctx context.Context, r *Registry, cluster *metav1.PartialObjectMetadata) {
+	secretName := cluster.Name + "-kubeconfig"
+	secret, err := s.clientset.CoreV1().Secrets(cluster.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			logrus.Debugf("the %s/%s cluster api cluster has no kubeconfig secret yet", cluster.Namespace, cluster.Name)
+		} else {
+			logrus.Errorf("unable to get the %s/%s secret: %v", cluster.Namespace, secretName, err)
+		}
+		r.Delete(cluster.UID)
+		return
+	}
+	kubeconfig, err := clientcmd.Load(secret.Data[clusterAPIKubeconfigKey])
+	if err != nil {
+		logrus.Errorf("unable to load the kubeconfig of the %s/%s secret: %v", secret.Namespace, secret.Name, err)
+		r.Delete(cluster.UID)
+		return
+	}
+	registration, err := contextRegistration(kubeconfig, kubeconfig.CurrentContext, SourceClusterAPI+"."+cluster.Namespace, cluster.UID)
+	if err != nil {
+		logrus.Errorf("unable to load the kubeconfig of the %s/%s secret: %v", secret.Namespace, secret.Name, err)
+		r.Delete(cluster.UID)
+		return
+	}
+	registration.Cluster.Name = cluster.Name
+	r.Register(SourceClusterAPI, registration)
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func clusterAPICluster(namespace, name, uid string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: ClusterAPIClusterResource.GroupVersion().String(), Kind: "Cluster"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(uid)},
+	}
+}
+
+func kubeconfigSecret(t *testing.T, namespace, clusterName string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: clusterName + "-kubeconfig"},
+		Data:       map[string][]byte{clusterAPIKubeconfigKey: kubeconfig(t, clusterName+"-admin@"+clusterName)},
+	}
+}
+
+func TestClusterAPISource(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		kubeconfigSecret(t, "fleet", "prod"),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "fleet", Name: "broken-kubeconfig"},
+			Data:       map[string][]byte{clusterAPIKubeconfigKey: []byte("{not yaml")},
+		},
+	)
+	scheme := runtime.NewScheme()
+	metav1.AddMetaToScheme(scheme)
+	metadataClient := metadatafake.NewSimpleMetadataClient(scheme,
+		clusterAPICluster("fleet", "prod", "uid-prod"),
+		// the clusters without a valid kubeconfig secret are left out
+		clusterAPICluster("fleet", "pending", "uid-pending"),
+		clusterAPICluster("fleet", "broken", "uid-broken"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := New()
+	if err := NewClusterAPISource(clientset, metadataClient, "fleet").Start(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	assertClusters(t, r, "prod=uid-prod")
+	cluster, _ := r.Get("prod")
+	restConfig, found := r.RestConfig(cluster)
+	if !found || restConfig.Host != "https://prod-admin@prod.example.com" || restConfig.BearerToken != "prod-admin@prod-token" {
+		t.Errorf("unexpected rest config %+v", restConfig)
+	}
+	if r.Source(cluster) != SourceClusterAPI || r.Instance(cluster) != "clusterapi.fleet" {
+		t.Errorf("got the source %q and the instance %q", r.Source(cluster), r.Instance(cluster))
+	}
+
+	// the secret of a new cluster is read along with the cluster
+	if _, err := clientset.CoreV1().Secrets("fleet").Create(ctx, kubeconfigSecret(t, "fleet", "staging"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	clusters := metadataClient.Resource(ClusterAPIClusterResource).Namespace("fleet")
+	if _, err := clusters.(metadatafake.MetadataClient).CreateFake(clusterAPICluster("fleet", "staging", "uid-staging"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the added staging cluster", func() bool {
+		return len(r.Clusters()) == 2
+	})
+	assertClusters(t, r, "prod=uid-prod", "staging=uid-staging")
+
+	if err := clusters.Delete(ctx, "prod", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the deleted prod cluster", func() bool {
+		return len(r.Clusters()) == 1
+	})
+	assertClusters(t, r, "staging=uid-staging")
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SourceKubeconfig names the source of the clusters of the mounted kubeconfig files
+const SourceKubeconfig = "kubeconfig"
+
+// KubeconfigSource registers a cluster for every context of a kubeconfig file, or of the files of
+// a directory such as a mounted secret. The files are read again every poll interval and the
+// clusters are reached with the credentials of their context.
+type KubeconfigSource struct {
+	Path         string
+	PollInterval time.Duration
+}
+
+func (s *KubeconfigSource) Name() string {
+	return SourceKubeconfig
+}
+
+// Start registers the contexts of the kubeconfig files and keeps polling them until ctx is done
+func (s *KubeconfigSource) Start(ctx context.Context, r *Registry) error {
+	registrations, err := s.load()
+	if err != nil {
+		return err
+	}
+	r.Sync(SourceKubeconfig, registrations)
+	logrus.Infof("registered %d clusters of the kubeconfig files in %s", len(registrations), s.Path)
+
+	go func() {
+		ticker := time.NewTicker(s.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				registrations, err := s.load()
+				if err != nil {
+					logrus.Errorf("unable to reload the kubeconfig files, keeping the known clusters: %v", err)
+					continue
+				}
+				r.Sync(SourceKubeconfig, registrations)
+			}
+		}
+	}()
+	return nil
+}
+
+// load reads the kubeconfig files; the contexts named like an already loaded one are skipped
+func (s *KubeconfigSource) load() ([]Registration, error) {
+	files, err := kubeconfigFiles(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var registrations []Registration
+	seen := make(map[string]string)
+	for _, file := range files {
+		kubeconfig, err := clientcmd.LoadFromFile(file)
+		if err != nil {
+			logrus.Errorf("unable to load the kubeconfig file %s: %v", file, err)
+			continue
+		}
+		contexts := make([]string, 0, len(kubeconfig.Contexts))
+		for name := range kubeconfig.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+		for _, name := range contexts {
+			if other, found := seen[name]; found {
+				logrus.Warnf("skipping the %s context of %s, already loaded from %s", name, file, other)
+				continue
+			}
+			registration, err := contextRegistration(kubeconfig, name, SourceKubeconfig, types.UID(SourceKubeconfig+":"+file+":"+name))
+			if err != nil {
+				logrus.Errorf("unable to load the %s context of %s: %v", name, file, err)
+				continue
+			}
+			seen[name] = file
+			registrations = append(registrations, registration)
+		}
+	}
+	return registrations, nil
+}
+
+// kubeconfigFiles lists the kubeconfig file at path, or the regular files of the directory at path;
+// the hidden entries are skipped, e.g. the ..data links of a mounted secret
+func kubeconfigFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the kubeconfig path %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the kubeconfig directory %s: %v", path, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(path, entry.Name())
+		// follows the symlinks of the mounted secrets
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// contextRegistration registers the cluster of a kubeconfig context under the context name
+func contextRegistration(kubeconfig *clientcmdapi.Config, contextName, instance string, uid types.UID) (Registration, error) {
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return Registration{}, err
+	}
+	cluster := argoAppV1.Cluster{
+		Name:   contextName,
+		Server: restConfig.Host,
+	}
+	return Registration{UID: uid, Cluster: cluster, Instance: instance, RestConfig: restConfig}, nil
+}
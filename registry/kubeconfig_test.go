@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeconfig returns a kubeconfig with a context per name, reaching https://<name>.example.com
+// with a token, the first context being the current one
+func kubeconfig(t *testing.T, contexts ...string) []byte {
+	config := clientcmdapi.NewConfig()
+	for _, name := range contexts {
+		config.Clusters[name] = &clientcmdapi.Cluster{Server: "https://" + name + ".example.com"}
+		config.AuthInfos[name] = &clientcmdapi.AuthInfo{Token: name + "-token"}
+		config.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	}
+	if len(contexts) > 0 {
+		config.CurrentContext = contexts[0]
+	}
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKubeconfigSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), kubeconfig(t, "prod", "staging"))
+	// the contexts already loaded from another file are skipped
+	writeFile(t, filepath.Join(dir, "b"), kubeconfig(t, "prod", "dev"))
+	writeFile(t, filepath.Join(dir, "broken"), []byte("{not yaml"))
+	writeFile(t, filepath.Join(dir, ".hidden"), kubeconfig(t, "hidden"))
+	if err := os.Mkdir(filepath.Join(dir, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := New()
+	source := &KubeconfigSource{Path: dir, PollInterval: 20 * time.Millisecond}
+	if err := source.Start(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	fileA, fileB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	assertClusters(t, r,
+		"dev=kubeconfig:"+fileB+":dev",
+		"prod=kubeconfig:"+fileA+":prod",
+		"staging=kubeconfig:"+fileA+":staging")
+
+	cluster, _ := r.Get("prod")
+	restConfig, found := r.RestConfig(cluster)
+	if !found || restConfig.Host != "https://prod.example.com" || restConfig.BearerToken != "prod-token" {
+		t.Errorf("unexpected rest config %+v", restConfig)
+	}
+	if cluster.Server != "https://prod.example.com" || r.Source(cluster) != SourceKubeconfig || r.Instance(cluster) != SourceKubeconfig {
+		t.Errorf("unexpected cluster %+v of the %s source", cluster, r.Source(cluster))
+	}
+
+	// the files are read again every poll interval
+	writeFile(t, fileA, kubeconfig(t, "staging"))
+	waitFor(t, "the reloaded kubeconfig files", func() bool {
+		return len(r.Clusters()) == 3 && r.Clusters()[1].ID == "kubeconfig:"+fileB+":prod"
+	})
+	assertClusters(t, r,
+		"dev=kubeconfig:"+fileB+":dev",
+		"prod=kubeconfig:"+fileB+":prod",
+		"staging=kubeconfig:"+fileA+":staging")
+}
+
+func TestKubeconfigSourceFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	writeFile(t, file, kubeconfig(t, "prod"))
+	r := New()
+	source := &KubeconfigSource{Path: file, PollInterval: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := source.Start(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	assertClusters(t, r, "prod=kubeconfig:"+file+":prod")
+
+	if err := (&KubeconfigSource{Path: filepath.Join(t.TempDir(), "missing")}).Start(ctx, r); err == nil {
+		t.Error("got no error with a missing kubeconfig path")
+	}
+}
@@ -0,0 +1,295 @@
+package registry
+
+import (
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	"sort"
+	"sync"
+)
+
+// LocalClusterID identifies the local cluster, which has no cluster secret
+const LocalClusterID = "in-cluster"
+
+// Registry holds the clusters fed by the cluster sources keyed by a unique id, the secret UID for
+// the ArgoCD clusters, along with the local cluster the helper runs in. Every cluster is tagged
+// with its source and its instance within the source, e.g. the namespace of an ArgoCD instance.
+type Registry struct {
+	mu       sync.RWMutex
+	clusters map[types.UID]entry
+	local    *argoAppV1.Cluster
+	// registered counts the registered clusters to order the clusters of the same name
+	registered uint64
+	// updates serializes the updates to tell the clusters each of them drops
+	updates sync.Mutex
+	// deletes guards the delete handlers along with the names of the dropped clusters waiting
+	// for them, dispatching tells whether a goroutine is calling the handlers
+	deletes        sync.Mutex
+	deleteHandlers []func(name string)
+	deleted        []string
+	dispatching    bool
+}
+
+type entry struct {
+	Registration
+	source string
+	seq    uint64
+}
+
+// Registration is a cluster registered by a source
+type Registration struct {
+	UID      types.UID
+	Cluster  argoAppV1.Cluster
+	Instance string
+	// RestConfig reaches the cluster instead of the config of the cluster, if set
+	RestConfig *rest.Config
+}
+
+func New() *Registry {
+	return &Registry{
+		clusters: make(map[types.UID]entry),
+	}
+}
+
+// QualifiedName is the name of a cluster that is registered under the same name by several
+// instances
+func QualifiedName(name, instance string) string {
+	return name + "@" + instance
+}
+
+// OnDelete calls handler with the name of every cluster leaving the registry, the names taken
+// over by another cluster included. The handlers are called in the background, one name at a
+// time in the order of the updates, so that the sources never wait for them.
+func (r *Registry) OnDelete(handler func(name string)) {
+	r.deletes.Lock()
+	defer r.deletes.Unlock()
+	r.deleteHandlers = append(r.deleteHandlers, handler)
+}
+
+// update applies an update of the registry and hands the names of the clusters it drops over to
+// the delete handlers
+func (r *Registry) update(apply func()) {
+	r.updates.Lock()
+	before := r.names()
+	r.mu.Lock()
+	apply()
+	r.mu.Unlock()
+	after := r.names()
+	r.updates.Unlock()
+
+	var deleted []string
+	for _, name := range sets.StringKeySet(before).List() {
+		if after[name] != before[name] {
+			logrus.Debugf("the %s cluster left the registry", name)
+			deleted = append(deleted, name)
+		}
+	}
+	r.dispatch(deleted)
+}
+
+// dispatch queues the names for the delete handlers, starting the goroutine calling them unless
+// it is running already
+func (r *Registry) dispatch(names []string) {
+	r.deletes.Lock()
+	defer r.deletes.Unlock()
+	if len(r.deleteHandlers) == 0 {
+		return
+	}
+	r.deleted = append(r.deleted, names...)
+	if r.dispatching || len(r.deleted) == 0 {
+		return
+	}
+	r.dispatching = true
+	go r.callDeleteHandlers()
+}
+
+// callDeleteHandlers calls the delete handlers with the queued names until none is left
+func (r *Registry) callDeleteHandlers() {
+	for {
+		r.deletes.Lock()
+		if len(r.deleted) == 0 {
+			r.dispatching = false
+			r.deletes.Unlock()
+			return
+		}
+		name := r.deleted[0]
+		r.deleted = r.deleted[1:]
+		handlers := r.deleteHandlers
+		r.deletes.Unlock()
+
+		for _, handler := range handlers {
+			handler(name)
+		}
+	}
+}
+
+// names returns the id of the cluster of every name
+func (r *Registry) names() map[string]string {
+	names := make(map[string]string)
+	for _, cluster := range r.Clusters() {
+		names[cluster.Name] = cluster.ID
+	}
+	return names
+}
+
+// Register adds or replaces a cluster of the given source
+func (r *Registry) Register(source string, registration Registration) {
+	r.update(func() {
+		logrus.Debugf("registering the %s cluster of the %s source", registration.Cluster.Name, source)
+		registration.Cluster.ID = string(registration.UID)
+		r.clusters[registration.UID] = entry{Registration: registration, source: source, seq: r.seq(registration.UID)}
+	})
+}
+
+// seq returns the registration order of the cluster, kept while the cluster stays registered
+func (r *Registry) seq(uid types.UID) uint64 {
+	if e, found := r.clusters[uid]; found {
+		return e.seq
+	}
+	r.registered++
+	return r.registered
+}
+
+// Sync replaces the clusters of the given source
+func (r *Registry) Sync(source string, registrations []Registration) {
+	r.update(func() {
+		synced := make(map[types.UID]entry, len(registrations))
+		for _, registration := range registrations {
+			registration.Cluster.ID = string(registration.UID)
+			synced[registration.UID] = entry{Registration: registration, source: source, seq: r.seq(registration.UID)}
+		}
+		for uid, e := range r.clusters {
+			if e.source == source {
+				delete(r.clusters, uid)
+			}
+		}
+		for uid, e := range synced {
+			r.clusters[uid] = e
+		}
+		logrus.Debugf("registered %d clusters of the %s source", len(registrations), source)
+	})
+}
+
+// Delete drops a registered cluster
+func (r *Registry) Delete(uid types.UID) {
+	r.update(func() {
+		if e, found := r.clusters[uid]; found {
+			logrus.Debugf("unregistering the %s cluster", e.Cluster.Name)
+			delete(r.clusters, uid)
+		}
+	})
+}
+
+// DeleteInstance drops the clusters of an instance of the given source
+func (r *Registry) DeleteInstance(source, instance string) {
+	r.update(func() {
+		for uid, e := range r.clusters {
+			if e.source == source && e.Instance == instance {
+				delete(r.clusters, uid)
+			}
+		}
+	})
+}
+
+// SetLocal registers the local cluster, listed unless a registered cluster holds the credentials
+// of the in-cluster API server address
+func (r *Registry) SetLocal(cluster *argoAppV1.Cluster) {
+	r.update(func() {
+		local := cluster.DeepCopy()
+		local.ID = LocalClusterID
+		r.local = local
+	})
+}
+
+// IsLocal tells whether the cluster is the local cluster, to be reached with the credentials
+// of the helper itself
+func IsLocal(cluster *argoAppV1.Cluster) bool {
+	return cluster.ID == LocalClusterID
+}
+
+// Clusters returns the registered clusters ordered by name. A cluster keeps its name while it
+// stays registered: the clusters registered later under the same name by other instances are
+// named after their instance, see QualifiedName.
+func (r *Registry) Clusters() []argoAppV1.Cluster {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	first := make(map[string]entry)
+	hasInClusterCredentials := false
+	for _, e := range r.clusters {
+		if owner, found := first[e.Cluster.Name]; !found || e.seq < owner.seq {
+			first[e.Cluster.Name] = e
+		}
+		if e.Cluster.Server == argoAppV1.KubernetesInternalAPIServerAddr {
+			hasInClusterCredentials = true
+		}
+	}
+
+	clusters := make([]argoAppV1.Cluster, 0, len(r.clusters)+1)
+	for _, e := range r.clusters {
+		cluster := e.Cluster.DeepCopy()
+		if owner := first[cluster.Name]; owner.UID != e.UID && owner.Instance != e.Instance {
+			cluster.Name = QualifiedName(cluster.Name, e.Instance)
+		}
+		clusters = append(clusters, *cluster)
+	}
+	if r.local != nil && !hasInClusterCredentials {
+		clusters = append(clusters, *r.local.DeepCopy())
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Name != clusters[j].Name {
+			return clusters[i].Name < clusters[j].Name
+		}
+		return clusters[i].ID < clusters[j].ID
+	})
+	return clusters
+}
+
+// Get returns the registered cluster of the given name, the qualified name being accepted for
+// every cluster
+func (r *Registry) Get(name string) (*argoAppV1.Cluster, bool) {
+	for _, cluster := range r.Clusters() {
+		if cluster.Name == name {
+			return &cluster, true
+		}
+		if instance := r.Instance(&cluster); instance != "" && QualifiedName(r.ArgoName(&cluster), instance) == name {
+			return &cluster, true
+		}
+	}
+	return nil, false
+}
+
+// Instance returns the instance the cluster is registered by, empty for the local cluster
+func (r *Registry) Instance(cluster *argoAppV1.Cluster) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clusters[types.UID(cluster.ID)].Instance
+}
+
+// Source returns the source the cluster is registered by, empty for the local cluster
+func (r *Registry) Source(cluster *argoAppV1.Cluster) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clusters[types.UID(cluster.ID)].source
+}
+
+// RestConfig returns the rest config the source of the cluster reaches it with, if any
+func (r *Registry) RestConfig(cluster *argoAppV1.Cluster) (*rest.Config, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if e, found := r.clusters[types.UID(cluster.ID)]; found && e.RestConfig != nil {
+		return rest.CopyConfig(e.RestConfig), true
+	}
+	return nil, false
+}
+
+// ArgoName returns the name the cluster is registered under in its instance
+func (r *Registry) ArgoName(cluster *argoAppV1.Cluster) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if e, found := r.clusters[types.UID(cluster.ID)]; found {
+		return e.Cluster.Name
+	}
+	return cluster.Name
+}
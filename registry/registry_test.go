@@ -0,0 +1,249 @@
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func registration(uid, name, instance string) Registration {
+	return Registration{
+		UID:      types.UID(uid),
+		Cluster:  argoAppV1.Cluster{Name: name, Server: "https://" + uid + ".example.com"},
+		Instance: instance,
+	}
+}
+
+// clusterNames returns the names of the registered clusters along with their ids
+func clusterNames(r *Registry) []string {
+	var names []string
+	for _, cluster := range r.Clusters() {
+		names = append(names, cluster.Name+"="+cluster.ID)
+	}
+	return names
+}
+
+func assertClusters(t *testing.T, r *Registry, want ...string) {
+	t.Helper()
+	if got := clusterNames(r); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got the clusters %v, want %v", got, want)
+	}
+}
+
+// waitFor polls the condition until it holds or the test times out
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistryEvents(t *testing.T) {
+	r := New()
+	r.Register(SourceArgoCD, registration("uid-prod", "prod", "argocd"))
+	r.Register(SourceArgoCD, registration("uid-staging", "staging", "argocd"))
+	assertClusters(t, r, "prod=uid-prod", "staging=uid-staging")
+
+	// an update of a secret keeps its cluster under the same id
+	updated := registration("uid-prod", "prod", "argocd")
+	updated.Cluster.Server = "https://prod.example.com"
+	r.Register(SourceArgoCD, updated)
+	assertClusters(t, r, "prod=uid-prod", "staging=uid-staging")
+	if cluster, found := r.Get("prod"); !found || cluster.Server != "https://prod.example.com" || cluster.ID != "uid-prod" {
+		t.Errorf("unexpected updated cluster %+v", cluster)
+	}
+	if r.Instance(&argoAppV1.Cluster{ID: "uid-prod"}) != "argocd" || r.Source(&argoAppV1.Cluster{ID: "uid-prod"}) != SourceArgoCD {
+		t.Error("the prod cluster lost its instance or source")
+	}
+
+	// a renamed secret is the same cluster under its new name
+	r.Register(SourceArgoCD, registration("uid-prod", "prod-eu", "argocd"))
+	assertClusters(t, r, "prod-eu=uid-prod", "staging=uid-staging")
+
+	r.Delete("uid-prod")
+	r.Delete("uid-unknown")
+	assertClusters(t, r, "staging=uid-staging")
+	if _, found := r.Get("prod-eu"); found {
+		t.Error("got the deleted cluster")
+	}
+}
+
+func TestRegistryQualifiedNames(t *testing.T) {
+	r := New()
+	r.Register(SourceArgoCD, registration("uid-a", "prod", "argocd"))
+	r.Register(SourceArgoCD, registration("uid-b", "prod", "team-a"))
+	// the same secret of the same instance seen twice keeps the name of the first
+	r.Register(SourceArgoCD, registration("uid-c", "prod", "argocd"))
+	assertClusters(t, r, "prod=uid-a", "prod=uid-c", "prod@team-a=uid-b")
+
+	// the first registered cluster keeps its name across its updates
+	r.Register(SourceArgoCD, registration("uid-a", "prod", "argocd"))
+	assertClusters(t, r, "prod=uid-a", "prod=uid-c", "prod@team-a=uid-b")
+
+	// the qualified name reaches every cluster
+	for name, id := range map[string]string{"prod": "uid-a", "prod@team-a": "uid-b", "prod@argocd": "uid-a"} {
+		if cluster, found := r.Get(name); !found || cluster.ID != id {
+			t.Errorf("Get(%q) = %+v, want the %s cluster", name, cluster, id)
+		}
+	}
+	if name := r.ArgoName(&argoAppV1.Cluster{ID: "uid-b", Name: "prod@team-a"}); name != "prod" {
+		t.Errorf("got the argo name %q, want prod", name)
+	}
+
+	// the name passes on to the next registered cluster once the first ones leave
+	r.Delete("uid-a")
+	r.Delete("uid-c")
+	assertClusters(t, r, "prod=uid-b")
+	r.Register(SourceArgoCD, registration("uid-a", "prod", "argocd"))
+	assertClusters(t, r, "prod=uid-b", "prod@argocd=uid-a")
+}
+
+func TestRegistrySyncAndInstances(t *testing.T) {
+	r := New()
+	r.Register(SourceArgoCD, registration("uid-prod", "prod", "argocd"))
+	r.Register(SourceArgoCD, registration("uid-team", "team", "team-a"))
+	r.Sync(SourceKubeconfig, []Registration{registration("kube-dev", "dev", SourceKubeconfig), registration("kube-qa", "qa", SourceKubeconfig)})
+	assertClusters(t, r, "dev=kube-dev", "prod=uid-prod", "qa=kube-qa", "team=uid-team")
+
+	// a sync replaces the clusters of its source only
+	r.Sync(SourceKubeconfig, []Registration{registration("kube-qa", "qa", SourceKubeconfig)})
+	assertClusters(t, r, "prod=uid-prod", "qa=kube-qa", "team=uid-team")
+
+	r.DeleteInstance(SourceArgoCD, "team-a")
+	r.DeleteInstance(SourceKubeconfig, "argocd")
+	assertClusters(t, r, "prod=uid-prod", "qa=kube-qa")
+}
+
+func TestRegistryLocal(t *testing.T) {
+	r := New()
+	r.SetLocal(&argoAppV1.Cluster{Name: "in-cluster", Server: argoAppV1.KubernetesInternalAPIServerAddr})
+	r.Register(SourceArgoCD, registration("uid-prod", "prod", "argocd"))
+	assertClusters(t, r, "in-cluster="+LocalClusterID, "prod=uid-prod")
+	if cluster, found := r.Get("in-cluster"); !found || !IsLocal(cluster) || r.Instance(cluster) != "" {
+		t.Errorf("unexpected local cluster %+v", cluster)
+	}
+
+	// a cluster secret of the in-cluster address takes the place of the local cluster
+	inCluster := registration("uid-local", "local", "argocd")
+	inCluster.Cluster.Server = argoAppV1.KubernetesInternalAPIServerAddr
+	r.Register(SourceArgoCD, inCluster)
+	assertClusters(t, r, "local=uid-local", "prod=uid-prod")
+}
+
+func TestRegistryConcurrentUpdates(t *testing.T) {
+	r := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			uid := fmt.Sprintf("uid-%02d", i)
+			for j := 0; j < 20; j++ {
+				r.Register(SourceArgoCD, registration(uid, fmt.Sprintf("cluster-%02d", i), "argocd"))
+				r.Clusters()
+				if i%2 == 1 {
+					r.Delete(types.UID(uid))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	// every cluster is keyed by its UID, the odd ones being deleted
+	clusters := r.Clusters()
+	if len(clusters) != 10 {
+		t.Fatalf("got %d clusters, want 10: %v", len(clusters), clusterNames(r))
+	}
+	for i, cluster := range clusters {
+		if want := fmt.Sprintf("uid-%02d", 2*i); cluster.ID != want || cluster.Name != fmt.Sprintf("cluster-%02d", 2*i) {
+			t.Errorf("got the %s cluster %s, want %s", cluster.Name, cluster.ID, want)
+		}
+	}
+}
+
+func TestRegistryOnDelete(t *testing.T) {
+	r := New()
+	deleted := make(chan string, 10)
+	r.OnDelete(func(name string) {
+		deleted <- name
+	})
+	receive := func(want ...string) {
+		t.Helper()
+		for _, name := range want {
+			select {
+			case got := <-deleted:
+				if got != name {
+					t.Errorf("got the deleted %s cluster, want %s", got, name)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for the deleted %s cluster", name)
+			}
+		}
+	}
+
+	r.Register(SourceArgoCD, registration("uid-a", "prod", "argocd"))
+	r.Register(SourceArgoCD, registration("uid-b", "prod", "team-a"))
+	r.Register(SourceArgoCD, registration("uid-staging", "staging", "argocd"))
+	// an update keeping the names drops none
+	r.Register(SourceArgoCD, registration("uid-staging", "staging", "argocd"))
+	r.Delete("uid-staging")
+	receive("staging")
+
+	// the prod name is taken over by the cluster of team-a, leaving its qualified name
+	r.Delete("uid-a")
+	receive("prod", "prod@team-a")
+
+	r.Sync(SourceKubeconfig, []Registration{registration("kube-dev", "dev", SourceKubeconfig)})
+	r.Sync(SourceKubeconfig, nil)
+	receive("dev")
+	select {
+	case name := <-deleted:
+		t.Errorf("got the unexpected deleted %s cluster", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRegistryOnDeleteInBackground(t *testing.T) {
+	r := New()
+	release := make(chan struct{})
+	deleted := make(chan string, 10)
+	r.OnDelete(func(name string) {
+		<-release
+		deleted <- name
+	})
+	r.Register(SourceArgoCD, registration("uid-prod", "prod", "argocd"))
+	r.Register(SourceArgoCD, registration("uid-staging", "staging", "argocd"))
+
+	// the updates don't wait for the blocked handler
+	done := make(chan struct{})
+	go func() {
+		r.Delete("uid-prod")
+		r.Delete("uid-staging")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deletes waited for the delete handler")
+	}
+
+	// the names are handed over in the order of the updates
+	close(release)
+	for _, want := range []string{"prod", "staging"} {
+		select {
+		case got := <-deleted:
+			if got != want {
+				t.Errorf("got the deleted %s cluster, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the deleted %s cluster", want)
+		}
+	}
+}
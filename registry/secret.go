@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/argoproj/argo-cd/v2/common"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecretToCluster converts a secret into a Cluster object
+func SecretToCluster(s *corev1.Secret) (*argoAppV1.Cluster, error) {
+	var clusterConfig argoAppV1.ClusterConfig
+	if len(s.Data["config"]) > 0 {
+		if err := json.Unmarshal(s.Data["config"], &clusterConfig); err != nil {
+			// This line has changed from the original Argo CD: now returns an error rather than panicing.
+			return nil, err
+		}
+	}
+
+	var namespaces []string
+	for _, ns := range strings.Split(string(s.Data["namespaces"]), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	var refreshRequestedAt *metav1.Time
+	if v, found := s.Annotations[argoAppV1.AnnotationKeyRefresh]; found {
+		requestedAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			logrus.Warnf("Error while parsing date in cluster secret '%s': %v", s.Name, err)
+		} else {
+			refreshRequestedAt = &metav1.Time{Time: requestedAt}
+		}
+	}
+	var shard *int64
+	if shardStr := s.Data["shard"]; shardStr != nil {
+		if val, err := strconv.Atoi(string(shardStr)); err != nil {
+			logrus.Warnf("Error while parsing shard in cluster secret '%s': %v", s.Name, err)
+		} else {
+			shard = pointer.Int64Ptr(int64(val))
+		}
+	}
+	labels := make(map[string]string)
+	for k, v := range s.Labels {
+		if k != common.LabelKeySecretType {
+			labels[k] = v
+		}
+	}
+	annotations := make(map[string]string)
+	for k, v := range s.Annotations {
+		if k != corev1.LastAppliedConfigAnnotation {
+			annotations[k] = v
+		}
+	}
+	cluster := argoAppV1.Cluster{
+		ID:                 string(s.UID),
+		Server:             strings.TrimRight(string(s.Data["server"]), "/"),
+		Name:               string(s.Data["name"]),
+		Namespaces:         namespaces,
+		Config:             clusterConfig,
+		RefreshRequestedAt: refreshRequestedAt,
+		Shard:              shard,
+		ClusterResources:   string(s.Data["clusterResources"]) == "true",
+		Project:            string(s.Data["project"]),
+		Labels:             labels,
+		Annotations:        annotations,
+	}
+	return &cluster, nil
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/argoproj/argo-cd/v2/common"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// clusterSecret returns the ArgoCD cluster secret of a cluster
+func clusterSecret(namespace, name, uid, clusterName, server string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       types.UID(uid),
+			Labels:    map[string]string{common.LabelKeySecretType: common.LabelValueSecretTypeCluster},
+		},
+		Data: map[string][]byte{
+			"name":   []byte(clusterName),
+			"server": []byte(server),
+			"config": []byte(`{"bearerToken":"token","tlsClientConfig":{"insecure":true}}`),
+		},
+	}
+}
+
+func TestSecretToCluster(t *testing.T) {
+	secret := clusterSecret("argocd", "cluster-prod", "uid-prod", "prod", "https://prod.example.com/")
+	secret.Labels["env"] = "prod"
+	secret.Annotations = map[string]string{
+		argoAppV1.AnnotationKeyRefresh:     "2023-05-01T10:00:00Z",
+		corev1.LastAppliedConfigAnnotation: "{}",
+		"team":                             "shop",
+	}
+	secret.Data["namespaces"] = []byte("shop, web,,")
+	secret.Data["clusterResources"] = []byte("true")
+	secret.Data["shard"] = []byte("2")
+	secret.Data["project"] = []byte("shop")
+
+	cluster, err := SecretToCluster(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.ID != "uid-prod" || cluster.Name != "prod" || cluster.Server != "https://prod.example.com" || cluster.Project != "shop" {
+		t.Errorf("unexpected cluster %+v", cluster)
+	}
+	if cluster.Config.BearerToken != "token" || !cluster.Config.Insecure {
+		t.Errorf("unexpected cluster config %+v", cluster.Config)
+	}
+	if len(cluster.Namespaces) != 2 || cluster.Namespaces[0] != "shop" || cluster.Namespaces[1] != "web" || !cluster.ClusterResources {
+		t.Errorf("got the namespaces %q, cluster resources %t", cluster.Namespaces, cluster.ClusterResources)
+	}
+	if cluster.Shard == nil || *cluster.Shard != 2 {
+		t.Errorf("got the shard %v, want 2", cluster.Shard)
+	}
+	if cluster.RefreshRequestedAt == nil || cluster.RefreshRequestedAt.UTC().Hour() != 10 {
+		t.Errorf("got the refresh request %v", cluster.RefreshRequestedAt)
+	}
+	// the secret type label and the last applied configuration are left out
+	if len(cluster.Labels) != 1 || cluster.Labels["env"] != "prod" {
+		t.Errorf("unexpected labels %v", cluster.Labels)
+	}
+	if _, found := cluster.Annotations[corev1.LastAppliedConfigAnnotation]; found || cluster.Annotations["team"] != "shop" {
+		t.Errorf("unexpected annotations %v", cluster.Annotations)
+	}
+}
+
+func TestSecretToClusterInvalid(t *testing.T) {
+	secret := clusterSecret("argocd", "cluster-prod", "uid-prod", "prod", "https://prod.example.com")
+	secret.Data["config"] = []byte("{not json")
+	if _, err := SecretToCluster(secret); err == nil {
+		t.Error("got no error with an invalid config")
+	}
+
+	// the invalid refresh annotation and shard are ignored
+	secret = clusterSecret("argocd", "cluster-prod", "uid-prod", "prod", "https://prod.example.com")
+	secret.Annotations = map[string]string{argoAppV1.AnnotationKeyRefresh: "yesterday"}
+	secret.Data["shard"] = []byte("first")
+	cluster, err := SecretToCluster(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.RefreshRequestedAt != nil || cluster.Shard != nil {
+		t.Errorf("got the refresh request %v and the shard %v", cluster.RefreshRequestedAt, cluster.Shard)
+	}
+}
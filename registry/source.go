@@ -0,0 +1,12 @@
+package registry
+
+import "context"
+
+// Source discovers clusters and keeps them registered
+type Source interface {
+	// Name names the source the clusters are tagged with
+	Name() string
+	// Start registers the clusters of the source and keeps them up to date until ctx is done,
+	// returning once the existing clusters are registered
+	Start(ctx context.Context, r *Registry) error
+}
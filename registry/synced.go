@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+)
+
+// handlerSync tells when the event handler of an informer has been given every object of the
+// informer store. The informer is synced once its store holds the initial list, possibly before
+// its handlers have registered the objects; client-go 0.24 has no handler registration to wait on
+type handlerSync struct {
+	mu      sync.Mutex
+	handled sets.String
+}
+
+func newHandlerSync() *handlerSync {
+	return &handlerSync{handled: sets.NewString()}
+}
+
+// wrap marks the objects as handled once the handler is done with them
+func (h *handlerSync) wrap(handler cache.ResourceEventHandlerFuncs) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if handler.AddFunc != nil {
+				handler.AddFunc(obj)
+			}
+			h.mark(obj, true)
+		},
+		UpdateFunc: func(oldObj, obj interface{}) {
+			if handler.UpdateFunc != nil {
+				handler.UpdateFunc(oldObj, obj)
+			}
+			h.mark(obj, true)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if handler.DeleteFunc != nil {
+				handler.DeleteFunc(obj)
+			}
+			h.mark(obj, false)
+		},
+	}
+}
+
+func (h *handlerSync) mark(obj interface{}, handled bool) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if handled {
+		h.handled.Insert(key)
+	} else {
+		h.handled.Delete(key)
+	}
+}
+
+// hasSynced tells whether the informer is synced and its handler has been given the objects of
+// the store
+func (h *handlerSync) hasSynced(informer cache.SharedIndexInformer) cache.InformerSynced {
+	return func() bool {
+		if !informer.HasSynced() {
+			return false
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.handled.HasAll(informer.GetStore().ListKeys()...)
+	}
+}
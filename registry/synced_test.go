@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// syncedInformer is an informer whose store holds the given objects, synced from the start
+type syncedInformer struct {
+	cache.SharedIndexInformer
+	store cache.Store
+}
+
+func (i *syncedInformer) HasSynced() bool {
+	return true
+}
+
+func (i *syncedInformer) GetStore() cache.Store {
+	return i.store
+}
+
+func TestHandlerSync(t *testing.T) {
+	prod := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "cluster-prod"}}
+	staging := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "cluster-staging"}}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, secret := range []*corev1.Secret{prod, staging} {
+		if err := store.Add(secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var handled []string
+	handlerSync := newHandlerSync()
+	handler := handlerSync.wrap(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handled = append(handled, obj.(*corev1.Secret).Name)
+		},
+	})
+	synced := handlerSync.hasSynced(&syncedInformer{store: store})
+
+	// the informer is synced before its handler got the objects of its store
+	if synced() {
+		t.Error("synced before the objects were handled")
+	}
+	handler.OnAdd(prod)
+	if synced() {
+		t.Error("synced with the staging secret left")
+	}
+	// the handlers without a func are marked as well
+	handler.OnUpdate(staging, staging)
+	if !synced() {
+		t.Error("not synced once every object was handled")
+	}
+	if len(handled) != 1 || handled[0] != "cluster-prod" {
+		t.Errorf("unexpected handled objects %v", handled)
+	}
+
+	// a deleted object is no longer waited on, a tombstone included
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "argocd/cluster-staging", Obj: staging})
+	if err := store.Delete(staging); err != nil {
+		t.Fatal(err)
+	}
+	if !synced() {
+		t.Error("not synced after the delete")
+	}
+	added := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "cluster-dev"}}
+	if err := store.Add(added); err != nil {
+		t.Fatal(err)
+	}
+	if synced() {
+		t.Error("synced with the dev secret not handled")
+	}
+}
@@ -0,0 +1,209 @@
+package report
+
+import (
+	"fmt"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/readiness"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	"hash/fnv"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"regexp"
+	"strings"
+)
+
+const (
+	Group   = "apid-helper.gkarthiks.io"
+	Version = "v1alpha1"
+	Kind    = "DeprecationReport"
+	// ManagedByLabel marks the reports written by the helper
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedBy      = "apid-helper"
+	// InstanceLabel tells the reports of the releases of the helper sharing a namespace apart
+	InstanceLabel = "app.kubernetes.io/instance"
+	// ReadinessLabel holds the readiness status of the cluster, e.g. to list the blocked clusters
+	ReadinessLabel = Group + "/readiness"
+
+	ConditionScanned = "Scanned"
+	ConditionReady   = "Ready"
+
+	// maxFindings keeps the reports well within the size limit of an object, the full findings
+	// being served by the api
+	maxFindings = 200
+)
+
+// Resource is the group-version-resource of the DeprecationReports
+var Resource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "deprecationreports"}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Spec identifies the cluster of a report
+type Spec struct {
+	ClusterName string `json:"clusterName"`
+	Instance    string `json:"instance,omitempty"`
+}
+
+// Status is the outcome of the last full scan of the cluster of a report
+type Status struct {
+	ServerVersion string      `json:"serverVersion,omitempty"`
+	TargetVersion string      `json:"targetVersion,omitempty"`
+	Readiness     string      `json:"readiness"`
+	ScannedAt     metav1.Time `json:"scannedAt"`
+	Counts        Counts      `json:"counts"`
+	Findings      []Finding   `json:"findings,omitempty"`
+	// OmittedFindings counts the findings left out of the report
+	OmittedFindings int                `json:"omittedFindings,omitempty"`
+	Conditions      []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Counts are the counts of the readiness of the cluster for the next minor version
+type Counts struct {
+	RemovedAPIs       int `json:"removedAPIs"`
+	DeprecatedAPIs    int `json:"deprecatedAPIs"`
+	FieldDeprecations int `json:"fieldDeprecations"`
+	BlockingFindings  int `json:"blockingFindings"`
+	Warnings          int `json:"warnings"`
+	CollectionGaps    int `json:"collectionGaps"`
+}
+
+// Finding is a deprecated API or field used by a resource of the cluster
+type Finding struct {
+	Type        string `json:"type"`
+	ApiVersion  string `json:"apiVersion"`
+	Kind        string `json:"kind"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name"`
+	Field       string `json:"field,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	RemovedIn   string `json:"removedIn,omitempty"`
+}
+
+// Name derives the name of the report of a cluster, hashing the cluster names that aren't valid
+// object names as is
+func Name(clusterName string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(clusterName), "-"), "-")
+	if name == clusterName && len(name) <= 63 {
+		return name
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(clusterName))
+	if len(name) > 54 {
+		name = strings.TrimRight(name[:54], "-")
+	}
+	if name == "" {
+		name = "cluster"
+	}
+	return fmt.Sprintf("%s-%08x", name, hash.Sum32())
+}
+
+// Build renders the report of the scanned cluster for the given release of the helper, carrying
+// the transition times of the conditions of the previous report over
+func Build(namespace, instance string, record store.Record, previous []metav1.Condition) (*unstructured.Unstructured, error) {
+	results := record.Results
+	clusterReadiness := readiness.Evaluate(record, "")
+	status := Status{
+		ServerVersion: results.ServerVersion,
+		TargetVersion: clusterReadiness.TargetVersion,
+		Readiness:     clusterReadiness.Status,
+		ScannedAt:     metav1.NewTime(record.ScannedAt),
+		Counts: Counts{
+			RemovedAPIs:       clusterReadiness.RemovedAPIs,
+			DeprecatedAPIs:    clusterReadiness.DeprecatedAPIs,
+			FieldDeprecations: clusterReadiness.FieldDeprecations,
+			BlockingFindings:  clusterReadiness.BlockingFindings,
+			Warnings:          clusterReadiness.Warnings,
+			CollectionGaps:    clusterReadiness.CollectionGaps,
+		},
+		Conditions: previous,
+	}
+
+	var findings []Finding
+	scanned := metav1.Condition{Type: ConditionScanned, Status: metav1.ConditionTrue, Reason: "Complete", Message: "every part of the cluster was scanned"}
+	switch result := results.Result.(type) {
+	case []judge.Result:
+		result = readiness.DeprecatedBy(result, clusterReadiness.TargetVersion)
+		for i := range result {
+			findings = append(findings, Finding{
+				Type:        "DeprecatedAPI",
+				ApiVersion:  result[i].ApiVersion,
+				Kind:        result[i].Kind,
+				Namespace:   result[i].Namespace,
+				Name:        result[i].Name,
+				Replacement: result[i].ReplaceWith,
+				RemovedIn:   readiness.JudgedRemovalRelease(&result[i]),
+			})
+		}
+	case nil:
+	default:
+		scanned = metav1.Condition{Type: ConditionScanned, Status: metav1.ConditionFalse, Reason: "Failed", Message: fmt.Sprint(result)}
+	}
+	if scanned.Status == metav1.ConditionTrue && len(results.CollectionErrors) > 0 {
+		scanned = metav1.Condition{Type: ConditionScanned, Status: metav1.ConditionTrue, Reason: "Incomplete", Message: strings.Join(results.CollectionErrors, "; ")}
+	}
+	for _, finding := range results.FieldFindings {
+		findings = append(findings, Finding{
+			Type:        "DeprecatedField",
+			ApiVersion:  finding.ApiVersion,
+			Kind:        finding.Kind,
+			Namespace:   finding.Namespace,
+			Name:        finding.Name,
+			Field:       finding.Path,
+			Replacement: finding.Replacement,
+			RemovedIn:   finding.RemovedIn,
+		})
+	}
+	if len(findings) > maxFindings {
+		status.OmittedFindings = len(findings) - maxFindings
+		findings = findings[:maxFindings]
+	}
+	status.Findings = findings
+
+	ready := metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Ready",
+		Message: fmt.Sprintf("ready for %s", clusterReadiness.TargetVersion)}
+	switch clusterReadiness.Status {
+	case readiness.StatusBlocked:
+		ready = metav1.Condition{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "Blocked",
+			Message: fmt.Sprintf("%d removed apis and %d blocking findings for %s", clusterReadiness.RemovedAPIs, clusterReadiness.BlockingFindings, clusterReadiness.TargetVersion)}
+	case readiness.StatusWarnings:
+		ready = metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Warnings",
+			Message: fmt.Sprintf("%d deprecated apis, %d field deprecations, %d warnings and %d collection gaps", clusterReadiness.DeprecatedAPIs,
+				clusterReadiness.FieldDeprecations, clusterReadiness.Warnings, clusterReadiness.CollectionGaps)}
+	}
+	meta.SetStatusCondition(&status.Conditions, scanned)
+	meta.SetStatusCondition(&status.Conditions, ready)
+
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&Spec{ClusterName: results.ClusterName, Instance: results.Instance})
+	if err != nil {
+		return nil, err
+	}
+	statusFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return nil, err
+	}
+	report := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   spec,
+		"status": statusFields,
+	}}
+	report.SetAPIVersion(Group + "/" + Version)
+	report.SetKind(Kind)
+	report.SetNamespace(namespace)
+	report.SetName(Name(results.ClusterName))
+	report.SetLabels(map[string]string{
+		ManagedByLabel: ManagedBy,
+		InstanceLabel:  instance,
+		ReadinessLabel: clusterReadiness.Status,
+	})
+	return report, nil
+}
+
+// Conditions reads the conditions of a report
+func Conditions(report *unstructured.Unstructured) []metav1.Condition {
+	var status Status
+	if fields, found, _ := unstructured.NestedMap(report.Object, "status"); found {
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(fields, &status)
+	}
+	return status.Conditions
+}
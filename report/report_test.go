@@ -0,0 +1,159 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/analysis"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/gkarthiks/argo-apid-helper/readiness"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	goversion "github.com/hashicorp/go-version"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestName(t *testing.T) {
+	long := strings.Repeat("cluster-", 10)
+	tests := []struct {
+		clusterName string
+		want        string
+	}{
+		{"in-cluster", "in-cluster"},
+		{"prod-eu-1", "prod-eu-1"},
+		{"Prod", "prod-"},
+		{"https://prod.example.com:6443", "https-prod-example-com-6443-"},
+		{".staging/eu", "staging-eu-"},
+		{"***", "cluster-"},
+		{long, strings.TrimRight(long[:54], "-") + "-"},
+	}
+	for _, test := range tests {
+		name := Name(test.clusterName)
+		if !strings.HasPrefix(name, test.want) || (name != test.want && len(name) != len(test.want)+8) {
+			t.Errorf("Name(%q) = %q, want %q with the hash of the invalid names", test.clusterName, name, test.want)
+		}
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			t.Errorf("Name(%q) = %q is not a valid name: %v", test.clusterName, name, errs)
+		}
+	}
+	if Name("Prod") == Name("prod-") || Name("prod/eu") == Name("prod.eu") {
+		t.Error("the names of different clusters collide")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	scannedAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	results := []judge.Result{
+		{
+			Name:        "web",
+			Namespace:   "shop",
+			Kind:        "Ingress",
+			ApiVersion:  "extensions/v1beta1",
+			RuleSet:     "Deprecated APIs removed in 1.22",
+			ReplaceWith: "networking.k8s.io/v1",
+			Since:       goversion.Must(goversion.NewVersion("1.14.0")),
+		},
+		{
+			// deprecated after the target version, left out
+			Name:       "api",
+			Namespace:  "shop",
+			Kind:       "FlowSchema",
+			ApiVersion: "flowcontrol.apiserver.k8s.io/v1beta3",
+			RuleSet:    "Deprecated APIs removed in 1.32",
+			Since:      goversion.Must(goversion.NewVersion("1.29.0")),
+		},
+	}
+	var fieldFindings []analysis.FieldFinding
+	for i := 0; i < maxFindings+10; i++ {
+		fieldFindings = append(fieldFindings, analysis.FieldFinding{
+			Name:       fmt.Sprintf("api-%d", i),
+			Namespace:  "shop",
+			Kind:       "Deployment",
+			ApiVersion: "apps/v1",
+			Path:       "spec.template.metadata.annotations[seccomp.security.alpha.kubernetes.io/pod]",
+			RemovedIn:  "1.27",
+		})
+	}
+	record := store.Record{
+		Results: &config.DeprecationResults{
+			ClusterName:   "Prod",
+			Instance:      "argocd",
+			ServerVersion: "1.24.3",
+			Result:        results,
+			FieldFindings: fieldFindings,
+		},
+		ScannedAt: scannedAt,
+	}
+	earlier := metav1.NewTime(scannedAt.Add(-time.Hour))
+	previous := []metav1.Condition{
+		{Type: ConditionScanned, Status: metav1.ConditionTrue, Reason: "Complete", LastTransitionTime: earlier},
+		{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Ready", LastTransitionTime: earlier},
+	}
+
+	report, err := Build("argocd", "apid-helper", record, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.GetName() != Name("Prod") || report.GetNamespace() != "argocd" || report.GetKind() != Kind {
+		t.Errorf("unexpected report %s %s/%s", report.GetKind(), report.GetNamespace(), report.GetName())
+	}
+	labels := report.GetLabels()
+	if labels[ManagedByLabel] != ManagedBy || labels[InstanceLabel] != "apid-helper" || labels[ReadinessLabel] != readiness.StatusBlocked {
+		t.Errorf("unexpected labels %v", labels)
+	}
+
+	var spec Spec
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(report.Object["spec"].(map[string]interface{}), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.ClusterName != "Prod" || spec.Instance != "argocd" {
+		t.Errorf("unexpected spec %+v", spec)
+	}
+	var status Status
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(report.Object["status"].(map[string]interface{}), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.TargetVersion != "1.25" || status.Readiness != readiness.StatusBlocked || !status.ScannedAt.Time.Equal(scannedAt) {
+		t.Errorf("unexpected status %s for %s scanned at %v", status.Readiness, status.TargetVersion, status.ScannedAt)
+	}
+	if status.Counts.RemovedAPIs != 1 || status.Counts.DeprecatedAPIs != 0 || status.Counts.FieldDeprecations != maxFindings+10 {
+		t.Errorf("unexpected counts %+v", status.Counts)
+	}
+	if len(status.Findings) != maxFindings || status.OmittedFindings != 11 {
+		t.Errorf("got %d findings and %d omitted, want %d and 11", len(status.Findings), status.OmittedFindings, maxFindings)
+	}
+	if finding := status.Findings[0]; finding.Type != "DeprecatedAPI" || finding.Kind != "Ingress" || finding.RemovedIn != "1.22" ||
+		finding.Replacement != "networking.k8s.io/v1" {
+		t.Errorf("unexpected finding %+v", finding)
+	}
+
+	// the transition time of an unchanged condition is carried over
+	scanned := meta.FindStatusCondition(status.Conditions, ConditionScanned)
+	if scanned == nil || scanned.Status != metav1.ConditionTrue || !scanned.LastTransitionTime.Equal(&earlier) {
+		t.Errorf("unexpected Scanned condition %+v", scanned)
+	}
+	ready := meta.FindStatusCondition(status.Conditions, ConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Reason != "Blocked" || ready.LastTransitionTime.Equal(&earlier) {
+		t.Errorf("unexpected Ready condition %+v", ready)
+	}
+}
+
+func TestBuildFailedScan(t *testing.T) {
+	record := store.Record{Results: &config.DeprecationResults{ClusterName: "prod", Result: "unable to reach the cluster"}}
+	report, err := Build("argocd", "apid-helper", record, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanned := meta.FindStatusCondition(Conditions(report), ConditionScanned)
+	if scanned == nil || scanned.Status != metav1.ConditionFalse || scanned.Reason != "Failed" || scanned.Message != "unable to reach the cluster" {
+		t.Errorf("unexpected Scanned condition %+v", scanned)
+	}
+	if report.GetLabels()[ReadinessLabel] != readiness.StatusWarnings {
+		t.Errorf("got the %s readiness, want %s", report.GetLabels()[ReadinessLabel], readiness.StatusWarnings)
+	}
+}
@@ -0,0 +1,94 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+)
+
+// Writer keeps a DeprecationReport per cluster in the given namespace, labelled with the instance
+// of the release of the helper
+type Writer struct {
+	client    dynamic.Interface
+	namespace string
+	instance  string
+}
+
+func NewWriter(client dynamic.Interface, namespace, instance string) *Writer {
+	return &Writer{client: client, namespace: namespace, instance: instance}
+}
+
+// Write creates or updates the report of the scanned cluster
+func (w *Writer) Write(ctx context.Context, record store.Record) error {
+	reports := w.client.Resource(Resource).Namespace(w.namespace)
+	name := Name(record.Results.ClusterName)
+	existing, err := reports.Get(ctx, name, metav1.GetOptions{})
+	var previous []metav1.Condition
+	switch {
+	case apierrors.IsNotFound(err):
+		existing = nil
+	case err != nil:
+		return fmt.Errorf("unable to read the %s/%s deprecation report: %w", w.namespace, name, err)
+	default:
+		previous = Conditions(existing)
+	}
+
+	report, err := Build(w.namespace, w.instance, record, previous)
+	if err != nil {
+		return fmt.Errorf("unable to build the deprecation report of %s: %w", record.Results.ClusterName, err)
+	}
+	if existing == nil {
+		existing, err = reports.Create(ctx, report, metav1.CreateOptions{})
+	} else {
+		report.SetResourceVersion(existing.GetResourceVersion())
+		existing, err = reports.Update(ctx, report, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write the %s/%s deprecation report: %w", w.namespace, name, err)
+	}
+
+	// the status is a subresource, left out by the create and the update
+	report.SetResourceVersion(existing.GetResourceVersion())
+	if _, err = reports.UpdateStatus(ctx, report, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to write the status of the %s/%s deprecation report: %w", w.namespace, name, err)
+	}
+	return nil
+}
+
+// Delete deletes the report of the given cluster, if any
+func (w *Writer) Delete(ctx context.Context, clusterName string) error {
+	name := Name(clusterName)
+	err := w.client.Resource(Resource).Namespace(w.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete the %s/%s deprecation report: %w", w.namespace, name, err)
+	}
+	return nil
+}
+
+// Prune deletes the reports of the clusters that are no longer managed; the reports of the other
+// releases of the helper are left alone
+func (w *Writer) Prune(ctx context.Context, clusterNames []string) error {
+	reports := w.client.Resource(Resource).Namespace(w.namespace)
+	selector := labels.SelectorFromSet(labels.Set{ManagedByLabel: ManagedBy, InstanceLabel: w.instance})
+	list, err := reports.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return fmt.Errorf("unable to list the deprecation reports of the %s namespace: %w", w.namespace, err)
+	}
+	managed := make(map[string]bool, len(clusterNames))
+	for _, clusterName := range clusterNames {
+		managed[Name(clusterName)] = true
+	}
+	for _, item := range list.Items {
+		if managed[item.GetName()] {
+			continue
+		}
+		if err = reports.Delete(ctx, item.GetName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete the %s/%s deprecation report: %w", w.namespace, item.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func testReport(name string, labels map[string]string) runtime.Object {
+	report := &unstructured.Unstructured{}
+	report.SetAPIVersion(Group + "/" + Version)
+	report.SetKind(Kind)
+	report.SetNamespace("argocd")
+	report.SetName(name)
+	report.SetLabels(labels)
+	return report
+}
+
+func TestWriterPrune(t *testing.T) {
+	ours := map[string]string{ManagedByLabel: ManagedBy, InstanceLabel: "apid-helper"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{Resource: Kind + "List"},
+		testReport("prod", ours),
+		testReport("gone", ours),
+		testReport(Name(".staging/eu"), ours),
+		// the reports of another release and the ones written by hand are kept
+		testReport("other", map[string]string{ManagedByLabel: ManagedBy, InstanceLabel: "apid-helper-canary"}),
+		testReport("manual", nil),
+	)
+	writer := NewWriter(client, "argocd", "apid-helper")
+	ctx := context.Background()
+	if err := writer.Prune(ctx, []string{"prod", ".staging/eu"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := client.Resource(Resource).Namespace("argocd").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := map[string]bool{}
+	for _, item := range list.Items {
+		kept[item.GetName()] = true
+	}
+	if len(kept) != 4 || kept["gone"] || !kept["prod"] || !kept[Name(".staging/eu")] || !kept["other"] || !kept["manual"] {
+		t.Errorf("unexpected reports after the prune %v", kept)
+	}
+}
@@ -0,0 +1,44 @@
+package shard
+
+import (
+	"fmt"
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Placeholder is replaced by the shard number in the URL template of the replicas
+const Placeholder = "{shard}"
+
+// Of returns the shard of the cluster among the given number of replicas: the shard of its cluster
+// secret when set, the FNV hash of the cluster id otherwise, as the ArgoCD application controller does
+func Of(cluster *argoAppV1.Cluster, replicas int) int {
+	if replicas <= 1 {
+		return 0
+	}
+	if cluster.Shard != nil && *cluster.Shard >= 0 {
+		return int(*cluster.Shard % int64(replicas))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(cluster.ID))
+	return int(h.Sum32() % uint32(replicas))
+}
+
+// OrdinalOf parses the ordinal of a StatefulSet pod out of its hostname, e.g. 2 for apid-helper-2
+func OrdinalOf(hostname string) (int, error) {
+	idx := strings.LastIndex(hostname, "-")
+	if idx < 0 {
+		return 0, fmt.Errorf("hostname %s has no ordinal suffix", hostname)
+	}
+	ordinal, err := strconv.Atoi(hostname[idx+1:])
+	if err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("hostname %s has no ordinal suffix", hostname)
+	}
+	return ordinal, nil
+}
+
+// PeerURL returns the URL of the replica serving the shard out of the URL template
+func PeerURL(template string, shard int) string {
+	return strings.ReplaceAll(template, Placeholder, strconv.Itoa(shard))
+}
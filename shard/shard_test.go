@@ -0,0 +1,68 @@
+package shard
+
+import (
+	"testing"
+
+	argoAppV1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+)
+
+func TestOf(t *testing.T) {
+	shardOf := func(shard int64) *int64 { return &shard }
+	tests := []struct {
+		cluster  argoAppV1.Cluster
+		replicas int
+		want     int
+	}{
+		{cluster: argoAppV1.Cluster{ID: "prod"}, replicas: 0, want: 0},
+		{cluster: argoAppV1.Cluster{ID: "prod", Shard: shardOf(2)}, replicas: 1, want: 0},
+		{cluster: argoAppV1.Cluster{ID: "prod", Shard: shardOf(2)}, replicas: 3, want: 2},
+		{cluster: argoAppV1.Cluster{ID: "prod", Shard: shardOf(5)}, replicas: 3, want: 2},
+		// the FNV-1a hash of the id: 0xed3e3174 for prod, 0x9ad76926 for staging
+		{cluster: argoAppV1.Cluster{ID: "prod", Shard: shardOf(-1)}, replicas: 3, want: 0xed3e3174 % 3},
+		{cluster: argoAppV1.Cluster{ID: "prod"}, replicas: 4, want: 0xed3e3174 % 4},
+		{cluster: argoAppV1.Cluster{ID: "staging"}, replicas: 4, want: 0x9ad76926 % 4},
+	}
+	for _, test := range tests {
+		if got := Of(&test.cluster, test.replicas); got != test.want {
+			t.Errorf("Of(%s, shard %v) among %d replicas = %d, want %d", test.cluster.ID, test.cluster.Shard, test.replicas, got, test.want)
+		}
+	}
+}
+
+func TestOrdinalOf(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     int
+		wantErr  bool
+	}{
+		{hostname: "apid-helper-0", want: 0},
+		{hostname: "apid-helper-12", want: 12},
+		{hostname: "apid-helper", wantErr: true},
+		{hostname: "helper", wantErr: true},
+		{hostname: "apid-helper-7d9f8b6c4-x2kqp", wantErr: true},
+		{hostname: "apid-helper-", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := OrdinalOf(test.hostname)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("OrdinalOf(%s) = %d, %v, want %d, error %t", test.hostname, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestPeerURL(t *testing.T) {
+	tests := []struct {
+		template string
+		shard    int
+		want     string
+	}{
+		{template: "http://apid-helper-{shard}.apid-helper-headless:80", shard: 2, want: "http://apid-helper-2.apid-helper-headless:80"},
+		{template: "http://{shard}.example.com/{shard}", shard: 0, want: "http://0.example.com/0"},
+		{template: "http://apid-helper:80", shard: 1, want: "http://apid-helper:80"},
+	}
+	for _, test := range tests {
+		if got := PeerURL(test.template, test.shard); got != test.want {
+			t.Errorf("PeerURL(%s, %d) = %s, want %s", test.template, test.shard, got, test.want)
+		}
+	}
+}
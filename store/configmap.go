@@ -0,0 +1,162 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/sirupsen/logrus"
+	"hash/fnv"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ScanResultLabel marks the ConfigMaps holding the scans
+	ScanResultLabel = "apid-helper.gkarthiks.io/scan-result"
+	// ClusterNameAnnotation holds the name of the cluster of the scan, which doesn't always fit
+	// in an object name
+	ClusterNameAnnotation = "apid-helper.gkarthiks.io/cluster-name"
+	recordKey             = "record.json.gz"
+)
+
+// ConfigMap keeps the last scan of every cluster in a ConfigMap of the given namespace, the
+// record gzipped to stay well within the size limit of a ConfigMap
+type ConfigMap struct {
+	clientset kubernetes.Interface
+	namespace string
+	prefix    string
+}
+
+func NewConfigMap(clientset kubernetes.Interface, namespace, prefix string) *ConfigMap {
+	return &ConfigMap{clientset: clientset, namespace: namespace, prefix: prefix}
+}
+
+func (c *ConfigMap) Save(ctx context.Context, results *config.DeprecationResults) error {
+	data, err := encodeRecord(newRecord(results))
+	if err != nil {
+		return fmt.Errorf("unable to encode the scan of %s: %w", results.ClusterName, err)
+	}
+	configMaps := c.clientset.CoreV1().ConfigMaps(c.namespace)
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        c.name(results.ClusterName),
+			Namespace:   c.namespace,
+			Labels:      map[string]string{ScanResultLabel: "true"},
+			Annotations: map[string]string{ClusterNameAnnotation: results.ClusterName},
+		},
+		BinaryData: map[string][]byte{recordKey: data},
+	}
+	_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// the last writer wins, every writer holding a complete scan
+		var existing *corev1.ConfigMap
+		if existing, err = configMaps.Get(ctx, configMap.Name, metav1.GetOptions{}); err == nil {
+			if owner := existing.Annotations[ClusterNameAnnotation]; owner != results.ClusterName {
+				// the configmap of another cluster of the same hash
+				return fmt.Errorf("unable to save the scan of %s: the %s/%s configmap holds the scan of %s", results.ClusterName, c.namespace, configMap.Name, owner)
+			}
+			configMap.ResourceVersion = existing.ResourceVersion
+			_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save the scan of %s in the %s/%s configmap: %w", results.ClusterName, c.namespace, configMap.Name, err)
+	}
+	return nil
+}
+
+func (c *ConfigMap) Get(ctx context.Context, clusterName string) (Record, bool, error) {
+	name := c.name(clusterName)
+	configMap, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("unable to read the scan of %s from the %s/%s configmap: %w", clusterName, c.namespace, name, err)
+	}
+	if configMap.Annotations[ClusterNameAnnotation] != clusterName {
+		return Record{}, false, nil
+	}
+	record, err := decodeRecord(configMap.BinaryData[recordKey])
+	if err != nil {
+		return Record{}, false, fmt.Errorf("unable to decode the scan in the %s/%s configmap: %w", c.namespace, name, err)
+	}
+	return record, true, nil
+}
+
+func (c *ConfigMap) List(ctx context.Context) ([]Record, error) {
+	configMaps, err := c.clientset.CoreV1().ConfigMaps(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: ScanResultLabel + "=true"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the scans in the %s namespace: %w", c.namespace, err)
+	}
+	records := make([]Record, 0, len(configMaps.Items))
+	for _, configMap := range configMaps.Items {
+		record, err := decodeRecord(configMap.BinaryData[recordKey])
+		if err != nil {
+			logrus.Errorf("skipping the scan in the %s/%s configmap: %v", c.namespace, configMap.Name, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func (c *ConfigMap) Delete(ctx context.Context, clusterName string) error {
+	name := c.name(clusterName)
+	configMaps := c.clientset.CoreV1().ConfigMaps(c.namespace)
+	configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err == nil && configMap.Annotations[ClusterNameAnnotation] != clusterName {
+		// the configmap of another cluster of the same hash
+		return nil
+	}
+	if err == nil {
+		err = configMaps.Delete(ctx, name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &configMap.UID}})
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete the scan of %s in the %s/%s configmap: %w", clusterName, c.namespace, name, err)
+	}
+	return nil
+}
+
+// name derives the name of the ConfigMap of a cluster from the hash of its name, the cluster
+// names not being valid object names at times
+func (c *ConfigMap) name(clusterName string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(clusterName))
+	return fmt.Sprintf("%s-%08x", c.prefix, hash.Sum32())
+}
+
+func encodeRecord(record Record) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(writer).Encode(record); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRecord(data []byte) (Record, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Record{}, err
+	}
+	defer reader.Close()
+	var record Record
+	if err = json.NewDecoder(io.LimitReader(reader, 64<<20)).Decode(&record); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const recordFileSuffix = ".json"
+
+// File keeps the last scan of every cluster as a JSON file in a directory, e.g. on a volume
+// mounted by every replica
+type File struct {
+	dir string
+}
+
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create the result directory %s: %w", dir, err)
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) Save(_ context.Context, results *config.DeprecationResults) error {
+	data, err := json.Marshal(newRecord(results))
+	if err != nil {
+		return fmt.Errorf("unable to encode the scan of %s: %w", results.ClusterName, err)
+	}
+	// written aside and renamed for the readers never to see a partial record
+	tmp, err := os.CreateTemp(f.dir, ".scan-*")
+	if err != nil {
+		return fmt.Errorf("unable to write the scan of %s: %w", results.ClusterName, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write the scan of %s: %w", results.ClusterName, err)
+	}
+	return os.Rename(tmp.Name(), f.path(results.ClusterName))
+}
+
+func (f *File) Get(_ context.Context, clusterName string) (Record, bool, error) {
+	record, err := readRecord(f.path(clusterName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+	return record, true, nil
+}
+
+func (f *File) List(_ context.Context) ([]Record, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the result directory %s: %w", f.dir, err)
+	}
+	records := make([]Record, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !strings.HasSuffix(entry.Name(), recordFileSuffix) {
+			continue
+		}
+		record, err := readRecord(filepath.Join(f.dir, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("skipping the scan in %s: %v", entry.Name(), err)
+			continue
+		}
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func (f *File) Delete(_ context.Context, clusterName string) error {
+	if err := os.Remove(f.path(clusterName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete the scan of %s: %w", clusterName, err)
+	}
+	return nil
+}
+
+// path names the file of a cluster after its escaped name, cluster names holding slashes at times;
+// a leading dot is escaped too since the hidden files are the ones being written
+func (f *File) path(clusterName string) string {
+	name := url.PathEscape(clusterName)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return filepath.Join(f.dir, name+recordFileSuffix)
+}
+
+func readRecord(path string) (Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Record{}, err
+	}
+	var record Record
+	if err = json.Unmarshal(data, &record); err != nil {
+		return Record{}, fmt.Errorf("unable to decode the scan in %s: %w", path, err)
+	}
+	return record, nil
+}
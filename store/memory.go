@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"sync"
+)
+
+// Memory keeps the last scan of every cluster in memory
+type Memory struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		records: make(map[string]Record),
+	}
+}
+
+func (m *Memory) Save(_ context.Context, results *config.DeprecationResults) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[results.ClusterName] = newRecord(results)
+	return nil
+}
+
+func (m *Memory) Get(_ context.Context, clusterName string) (Record, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, found := m.records[clusterName]
+	return record, found, nil
+}
+
+func (m *Memory) List(_ context.Context) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	records := make([]Record, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func (m *Memory) Delete(_ context.Context, clusterName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, clusterName)
+	return nil
+}
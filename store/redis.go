@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Redis keeps the last scan of every cluster in a Redis hash, the field of a cluster holding its
+// JSON record
+type Redis struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedis connects to the Redis server of the given URL, e.g. redis://:password@redis:6379/0
+func NewRedis(ctx context.Context, redisURL, key string) (*Redis, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err = client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to reach redis at %s: %w", opts.Addr, err)
+	}
+	return &Redis{client: client, key: key}, nil
+}
+
+func (r *Redis) Save(ctx context.Context, results *config.DeprecationResults) error {
+	data, err := json.Marshal(newRecord(results))
+	if err != nil {
+		return fmt.Errorf("unable to encode the scan of %s: %w", results.ClusterName, err)
+	}
+	if err = r.client.HSet(ctx, r.key, results.ClusterName, data).Err(); err != nil {
+		return fmt.Errorf("unable to save the scan of %s in redis: %w", results.ClusterName, err)
+	}
+	return nil
+}
+
+func (r *Redis) Get(ctx context.Context, clusterName string) (Record, bool, error) {
+	data, err := r.client.HGet(ctx, r.key, clusterName).Bytes()
+	if err == redis.Nil {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("unable to read the scan of %s from redis: %w", clusterName, err)
+	}
+	var record Record
+	if err = json.Unmarshal(data, &record); err != nil {
+		return Record{}, false, fmt.Errorf("unable to decode the scan of %s: %w", clusterName, err)
+	}
+	return record, true, nil
+}
+
+func (r *Redis) List(ctx context.Context) ([]Record, error) {
+	fields, err := r.client.HGetAll(ctx, r.key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the scans in redis: %w", err)
+	}
+	records := make([]Record, 0, len(fields))
+	for clusterName, data := range fields {
+		var record Record
+		if err = json.Unmarshal([]byte(data), &record); err != nil {
+			logrus.Errorf("skipping the scan of %s in redis: %v", clusterName, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func (r *Redis) Delete(ctx context.Context, clusterName string) error {
+	if err := r.client.HDel(ctx, r.key, clusterName).Err(); err != nil {
+		return fmt.Errorf("unable to delete the scan of %s in redis: %w", clusterName, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	"sort"
+	"time"
+)
+
+// Record is the outcome of the last full scan of a cluster
+type Record struct {
+	Results   *config.DeprecationResults `json:"results"`
+	ScannedAt time.Time                  `json:"scannedAt"`
+}
+
+// Store keeps the last scan of every cluster; the stores other than Memory outlive the replica
+// and are shared by the replicas using the same backend
+type Store interface {
+	// Save records the results as the last scan of their cluster
+	Save(ctx context.Context, results *config.DeprecationResults) error
+	// Get returns the last scan of the given cluster
+	Get(ctx context.Context, clusterName string) (Record, bool, error)
+	// List returns the last scan of every cluster ordered by the cluster name, the records that
+	// can't be read being logged and skipped
+	List(ctx context.Context) ([]Record, error)
+	// Delete drops the last scan of the given cluster, if any
+	Delete(ctx context.Context, clusterName string) error
+}
+
+func newRecord(results *config.DeprecationResults) Record {
+	return Record{Results: results, ScannedAt: time.Now()}
+}
+
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Results.ClusterName < records[j].Results.ClusterName
+	})
+}
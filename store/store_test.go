@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/config"
+	goversion "github.com/hashicorp/go-version"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testStore saves a judged scan and a failed one, reads them back and deletes them
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	judged := &config.DeprecationResults{
+		ClusterName:   "prod",
+		ServerVersion: "1.21",
+		Result: []judge.Result{{
+			Name:        "web",
+			Namespace:   "shop",
+			Kind:        "Ingress",
+			ApiVersion:  "extensions/v1beta1",
+			RuleSet:     "Deprecated APIs removed in 1.22",
+			ReplaceWith: "networking.k8s.io/v1",
+			Since:       goversion.Must(goversion.NewVersion("1.14.0")),
+		}},
+	}
+	failed := &config.DeprecationResults{ClusterName: ".staging/eu", Result: "unable to reach the cluster"}
+	for _, results := range []*config.DeprecationResults{judged, failed} {
+		if err := store.Save(ctx, results); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record, found, err := store.Get(ctx, "prod")
+	if err != nil || !found {
+		t.Fatalf("got the prod scan %t: %v", found, err)
+	}
+	results, ok := record.Results.Result.([]judge.Result)
+	if !ok || len(results) != 1 {
+		t.Fatalf("got the %T result %+v, want a []judge.Result", record.Results.Result, record.Results.Result)
+	}
+	if results[0].Since == nil || results[0].Since.String() != "1.14.0" || results[0].Name != "web" {
+		t.Errorf("unexpected result %+v", results[0])
+	}
+	if record.ScannedAt.IsZero() {
+		t.Error("the scan time is missing")
+	}
+
+	record, found, err = store.Get(ctx, ".staging/eu")
+	if err != nil || !found {
+		t.Fatalf("got the .staging/eu scan %t: %v", found, err)
+	}
+	if result, ok := record.Results.Result.(string); !ok || result != "unable to reach the cluster" {
+		t.Errorf("got the %T result %+v, want the scan error", record.Results.Result, record.Results.Result)
+	}
+
+	records, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Results.ClusterName != ".staging/eu" || records[1].Results.ClusterName != "prod" {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = store.Delete(ctx, "prod"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, found, err = store.Get(ctx, "prod"); err != nil || found {
+		t.Errorf("got the deleted prod scan %t: %v", found, err)
+	}
+	if records, err = store.List(ctx); err != nil || len(records) != 1 {
+		t.Errorf("got %d records after the delete: %v", len(records), err)
+	}
+}
+
+// testListSkips checks that a record that can't be read doesn't hide the other ones
+func testListSkips(t *testing.T, store Store) {
+	records, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Results.ClusterName != "prod" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestFile(t *testing.T) {
+	store, err := NewFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestFileListSkipsBadRecords(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(context.Background(), &config.DeprecationResults{ClusterName: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "broken"+recordFileSuffix), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testListSkips(t, store)
+}
+
+func TestConfigMap(t *testing.T) {
+	testStore(t, NewConfigMap(fake.NewSimpleClientset(), "apid-helper", "apid-helper-scan"))
+}
+
+func TestConfigMapListSkipsBadRecords(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "apid-helper-scan-broken",
+			Namespace: "apid-helper",
+			Labels:    map[string]string{ScanResultLabel: "true"},
+		},
+		BinaryData: map[string][]byte{recordKey: []byte("not gzipped")},
+	})
+	store := NewConfigMap(clientset, "apid-helper", "apid-helper-scan")
+	if err := store.Save(context.Background(), &config.DeprecationResults{ClusterName: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	testListSkips(t, store)
+}
+
+func TestConfigMapSaveHashCollision(t *testing.T) {
+	store := NewConfigMap(fake.NewSimpleClientset(), "apid-helper", "apid-helper-scan")
+	// the configmap of another cluster under the name of the prod scans
+	other := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        store.name("prod"),
+			Namespace:   "apid-helper",
+			Labels:      map[string]string{ScanResultLabel: "true"},
+			Annotations: map[string]string{ClusterNameAnnotation: "staging"},
+		},
+		BinaryData: map[string][]byte{recordKey: []byte("staging scan")},
+	}
+	ctx := context.Background()
+	if _, err := store.clientset.CoreV1().ConfigMaps("apid-helper").Create(ctx, other, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Save(ctx, &config.DeprecationResults{ClusterName: "prod"}); err == nil {
+		t.Error("saved the prod scan over the staging one")
+	}
+	configMap, err := store.clientset.CoreV1().ConfigMaps("apid-helper").Get(ctx, other.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configMap.Annotations[ClusterNameAnnotation] != "staging" || string(configMap.BinaryData[recordKey]) != "staging scan" {
+		t.Errorf("the staging scan was overwritten: %+v", configMap)
+	}
+}
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	store, err := NewRedis(context.Background(), "redis://"+server.Addr(), "apid-helper-scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.client.Close() })
+	return store, server
+}
+
+func TestRedis(t *testing.T) {
+	store, _ := newTestRedis(t)
+	testStore(t, store)
+}
+
+func TestRedisListSkipsBadRecords(t *testing.T) {
+	store, server := newTestRedis(t)
+	if err := store.Save(context.Background(), &config.DeprecationResults{ClusterName: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	server.HSet("apid-helper-scan", "broken", "{")
+	testListSkips(t, store)
+}
@@ -0,0 +1,191 @@
+package summary
+
+import (
+	"github.com/doitintl/kube-no-trouble/pkg/judge"
+	"github.com/gkarthiks/argo-apid-helper/readiness"
+	"github.com/gkarthiks/argo-apid-helper/store"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sort"
+	"time"
+)
+
+// UnmanagedProject groups the deprecated resources no Argo application is known to deploy
+const UnmanagedProject = "(unmanaged)"
+
+// ProjectResolver returns the Argo project deploying the given resource of a cluster, empty when unknown
+type ProjectResolver func(clusterName, kind, namespace, name string) string
+
+// Summary aggregates the last scans of the clusters
+type Summary struct {
+	TotalClusters       int                `json:"totalClusters"`
+	TotalDeprecatedAPIs int                `json:"totalDeprecatedAPIs"`
+	Clusters            []ClusterSummary   `json:"clusters"`
+	APIs                []APISummary       `json:"apis"`
+	Namespaces          []NamespaceSummary `json:"namespaces"`
+	Projects            []ProjectSummary   `json:"projects"`
+}
+
+// ClusterSummary counts the findings of a cluster
+type ClusterSummary struct {
+	ClusterName       string    `json:"clusterName"`
+	DeprecatedAPIs    int       `json:"deprecatedAPIs"`
+	FieldDeprecations int       `json:"fieldDeprecations"`
+	CollectionErrors  int       `json:"collectionErrors"`
+	ScanError         string    `json:"scanError,omitempty"`
+	ScannedAt         time.Time `json:"scannedAt"`
+}
+
+// APISummary counts the resources using a deprecated group/version/kind and lists the affected clusters
+type APISummary struct {
+	Group       string   `json:"group"`
+	Version     string   `json:"version"`
+	Kind        string   `json:"kind"`
+	ReplaceWith string   `json:"replaceWith,omitempty"`
+	RuleSet     string   `json:"ruleSet,omitempty"`
+	Count       int      `json:"count"`
+	Clusters    []string `json:"clusters"`
+}
+
+// NamespaceSummary counts the deprecated resources of a namespace across the clusters
+type NamespaceSummary struct {
+	Namespace string   `json:"namespace"`
+	Count     int      `json:"count"`
+	Clusters  []string `json:"clusters"`
+}
+
+// ProjectSummary counts the deprecated resources deployed by the applications of an Argo project
+type ProjectSummary struct {
+	Project  string   `json:"project"`
+	Count    int      `json:"count"`
+	Clusters []string `json:"clusters"`
+}
+
+type apiKey struct {
+	group   string
+	version string
+	kind    string
+}
+
+type tally struct {
+	count    int
+	clusters sets.String
+}
+
+type apiTally struct {
+	api APISummary
+	tally
+}
+
+func (t *tally) add(clusterName string) {
+	t.count++
+	t.clusters.Insert(clusterName)
+}
+
+// Build aggregates the given scans; cluster-scoped resources are left out of the namespace counts
+func Build(records []store.Record, projectOf ProjectResolver) *Summary {
+	summary := &Summary{
+		TotalClusters: len(records),
+		Clusters:      []ClusterSummary{},
+		APIs:          []APISummary{},
+		Namespaces:    []NamespaceSummary{},
+		Projects:      []ProjectSummary{},
+	}
+	apis := make(map[apiKey]*apiTally)
+	namespaces := make(map[string]*tally)
+	projects := make(map[string]*tally)
+	count := func(tallies map[string]*tally, key, clusterName string) {
+		if tallies[key] == nil {
+			tallies[key] = &tally{clusters: sets.NewString()}
+		}
+		tallies[key].add(clusterName)
+	}
+
+	for _, record := range records {
+		results := record.Results
+		clusterSummary := ClusterSummary{
+			ClusterName:       results.ClusterName,
+			FieldDeprecations: len(results.FieldFindings),
+			CollectionErrors:  len(results.CollectionErrors),
+			ScannedAt:         record.ScannedAt,
+		}
+
+		switch result := results.Result.(type) {
+		case []judge.Result:
+			// the APIs deprecated in the version of the cluster, as the deprecation apis return them
+			for _, r := range readiness.DeprecatedBy(result, results.ServerVersion) {
+				clusterSummary.DeprecatedAPIs++
+				gv, _ := schema.ParseGroupVersion(r.ApiVersion)
+				key := apiKey{group: gv.Group, version: gv.Version, kind: r.Kind}
+				if apis[key] == nil {
+					apis[key] = &apiTally{
+						api:   APISummary{Group: gv.Group, Version: gv.Version, Kind: r.Kind, ReplaceWith: r.ReplaceWith, RuleSet: r.RuleSet},
+						tally: tally{clusters: sets.NewString()},
+					}
+				}
+				apis[key].add(results.ClusterName)
+
+				if r.Namespace != "" {
+					count(namespaces, r.Namespace, results.ClusterName)
+				}
+				project := ""
+				if projectOf != nil {
+					project = projectOf(results.ClusterName, r.Kind, r.Namespace, r.Name)
+				}
+				if project == "" {
+					project = UnmanagedProject
+				}
+				count(projects, project, results.ClusterName)
+			}
+		case nil:
+			// nothing judged
+		default:
+			if err, ok := result.(error); ok {
+				clusterSummary.ScanError = err.Error()
+			} else if message, ok := result.(string); ok {
+				clusterSummary.ScanError = message
+			}
+		}
+		summary.TotalDeprecatedAPIs += clusterSummary.DeprecatedAPIs
+		summary.Clusters = append(summary.Clusters, clusterSummary)
+	}
+
+	for _, t := range apis {
+		api := t.api
+		api.Count = t.count
+		api.Clusters = t.clusters.List()
+		summary.APIs = append(summary.APIs, api)
+	}
+	sort.Slice(summary.APIs, func(i, j int) bool {
+		a, b := summary.APIs[i], summary.APIs[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Group+"/"+a.Version+"/"+a.Kind < b.Group+"/"+b.Version+"/"+b.Kind
+	})
+	for namespace, t := range namespaces {
+		summary.Namespaces = append(summary.Namespaces, NamespaceSummary{Namespace: namespace, Count: t.count, Clusters: t.clusters.List()})
+	}
+	sort.Slice(summary.Namespaces, func(i, j int) bool {
+		if summary.Namespaces[i].Count != summary.Namespaces[j].Count {
+			return summary.Namespaces[i].Count > summary.Namespaces[j].Count
+		}
+		return summary.Namespaces[i].Namespace < summary.Namespaces[j].Namespace
+	})
+	for project, t := range projects {
+		summary.Projects = append(summary.Projects, ProjectSummary{Project: project, Count: t.count, Clusters: t.clusters.List()})
+	}
+	sort.Slice(summary.Projects, func(i, j int) bool {
+		if summary.Projects[i].Count != summary.Projects[j].Count {
+			return summary.Projects[i].Count > summary.Projects[j].Count
+		}
+		return summary.Projects[i].Project < summary.Projects[j].Project
+	})
+	sort.Slice(summary.Clusters, func(i, j int) bool {
+		if summary.Clusters[i].DeprecatedAPIs != summary.Clusters[j].DeprecatedAPIs {
+			return summary.Clusters[i].DeprecatedAPIs > summary.Clusters[j].DeprecatedAPIs
+		}
+		return summary.Clusters[i].ClusterName < summary.Clusters[j].ClusterName
+	})
+	return summary
+}